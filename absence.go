@@ -0,0 +1,221 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+type silenceOp struct {
+	all   bool
+	ids   []xid.ID
+	refs  map[xid.ID]struct{}
+	op    Token
+	value time.Duration
+	pos   Pos
+}
+
+func newSilenceOp(lhs *SilenceLit, rhs *DurationLit, op Token) silenceOp {
+	n := silenceOp{
+		all:   lhs.All || len(lhs.Ref) == 0,
+		ids:   lhs.Ref,
+		op:    op,
+		value: rhs.Value,
+		pos:   lhs.Pos,
+	}
+	if len(lhs.Ref) > 0 {
+		n.refs = make(map[xid.ID]struct{}, len(lhs.Ref))
+		for _, ref := range lhs.Ref {
+			n.refs[ref] = struct{}{}
+		}
+	}
+	return n
+}
+
+func (n silenceOp) refIDs() (refs map[xid.ID]Token) {
+	if len(n.ids) == 0 {
+		return
+	}
+	refs = make(map[xid.ID]Token, len(n.ids))
+	for _, id := range n.ids {
+		refs[id] = DEVICES
+	}
+	return
+}
+
+func (n silenceOp) evaluate(_ context.Context, d *Device, state *State, _ reference, _ *specProps) (match Match, err error) {
+	match.Left.Keyword = SILENCE
+	match.Left.Refs = n.ids
+	match.Right.Keyword = DURATION
+	match.Operator = n.op
+	match.Pos = n.pos
+	if d == nil || state == nil {
+		return
+	}
+	if !n.covers(d.ID) {
+		return
+	}
+	silence := time.Duration(state.now-d.DateTime) * time.Second
+	switch n.op {
+	case EQ:
+		match.Ok = silence == n.value
+	case LT:
+		match.Ok = silence < n.value
+	case GT:
+		match.Ok = silence > n.value
+	case NE:
+		match.Ok = silence != n.value
+	case LTE:
+		match.Ok = silence <= n.value
+	case GTE:
+		match.Ok = silence >= n.value
+	}
+	return
+}
+
+func (n silenceOp) covers(id DeviceID) bool {
+	if n.all {
+		return true
+	}
+	_, ok := n.refs[id]
+	return ok
+}
+
+// setupAbsence marks specs made of silence conditions only. Such rules
+// are evaluated by the timer, not by incoming reports.
+func (s *spec) setupAbsence() error {
+	var silence int
+	for _, node := range s.nodes {
+		if _, ok := node.(silenceOp); ok {
+			silence++
+		}
+	}
+	if silence == 0 {
+		return nil
+	}
+	if silence != len(s.nodes) {
+		return fmt.Errorf("spinix/runtime: silence cannot be combined with report conditions")
+	}
+	s.isAbsence = true
+	s.isStateful = true
+	return nil
+}
+
+func (s *spec) silenceTargets() (all bool, refs []xid.ID) {
+	for _, node := range s.nodes {
+		silence, ok := node.(silenceOp)
+		if !ok {
+			continue
+		}
+		if silence.all {
+			all = true
+		}
+		refs = append(refs, silence.ids...)
+	}
+	return
+}
+
+// DetectAbsence evaluates all silence rules against the last known
+// reports of their devices at the current clock time. A rule with
+// coordinates only watches the devices last seen in its area.
+func (e *Engine) DetectAbsence(ctx context.Context) (events []Event, err error) {
+	scanner, ok := e.refs.rules.(ruleScanner)
+	if !ok {
+		return nil, fmt.Errorf("spinix/engine: %T does not support scanning", e.refs.rules)
+	}
+	var rules []*Rule
+	scanner.scan(func(rule *Rule) {
+		if rule.spec.isAbsence && !e.refIndex.isInvalid(rule.ID()) {
+			rules = append(rules, rule)
+		}
+	})
+	env := evalEnv{now: e.clock.Now().Unix()}
+	for _, rule := range rules {
+		devices, err := e.absenceTargets(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			match, status, err := rule.spec.evaluate(ctx, rule.id, device, env, e.refs)
+			if err != nil {
+				return nil, err
+			}
+			if status {
+				events = append(events, MakeEventAt(device, rule, match, env.now))
+			}
+		}
+	}
+	return e.emit(ctx, events)
+}
+
+// RunAbsence calls DetectAbsence every interval and passes the events
+// to fn until the context is done.
+func (e *Engine) RunAbsence(ctx context.Context, interval time.Duration, fn func(events []Event)) error {
+	if interval <= 0 {
+		return fmt.Errorf("spinix/engine: absence interval not specified")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			events, err := e.DetectAbsence(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return err
+			}
+			if len(events) > 0 {
+				fn(events)
+			}
+		}
+	}
+}
+
+func (e *Engine) absenceTargets(ctx context.Context, rule *Rule) ([]*Device, error) {
+	all, refs := rule.spec.silenceTargets()
+	seen := make(map[DeviceID]struct{})
+	devices := make([]*Device, 0, len(refs))
+	for _, id := range refs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		device, err := e.refs.devices.Lookup(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrDeviceNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if !rule.covers(device.Latitude, device.Longitude) {
+			continue
+		}
+		last := *device
+		devices = append(devices, &last)
+	}
+	if !all {
+		return devices, nil
+	}
+	scanner, ok := e.refs.devices.(deviceScanner)
+	if !ok {
+		return nil, fmt.Errorf("spinix/engine: %T does not support scanning", e.refs.devices)
+	}
+	scanner.scan(func(device *Device) {
+		if _, ok := seen[device.ID]; ok {
+			return
+		}
+		if device.Layer != rule.spec.props.layer || !rule.covers(device.Latitude, device.Longitude) {
+			return
+		}
+		last := *device
+		devices = append(devices, &last)
+	})
+	return devices, nil
+}
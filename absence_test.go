@@ -0,0 +1,129 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineDetectAbsence(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(WithClock(ClockFunc(func() time.Time { return now })))
+	silent := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	active := makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.2792333)
+	for _, device := range []*Device{silent, active} {
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rule, err := engine.AddRule(ctx, `silence(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseauog) gt 30m { :trigger once }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.spec.isAbsence {
+		t.Fatal("have stateless rule, want absence rule")
+	}
+	now = now.Add(20 * time.Minute)
+	events, err := engine.DetectAbsence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("have %d events, want 0", len(events))
+	}
+	if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.2792333)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(11 * time.Minute)
+	events, err = engine.DetectAbsence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Device.ID != silent.ID {
+		t.Fatalf("have %v, want one event for %s", events, silent.ID)
+	}
+	// trigger once
+	events, err = engine.DetectAbsence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("have %d events, want 0", len(events))
+	}
+}
+
+func TestSilenceSpec(t *testing.T) {
+	specs := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: `silence gt 30m`},
+		{spec: `silence(c5vj26evvhfjvfseauk0) gte 1h { :center 42.9236075 -72.2792333 }`},
+		{spec: `silence gt 30m and speed gt 10`, err: true},
+		{spec: `silence gt 30`, err: true},
+	}
+	for _, tc := range specs {
+		_, err := NewRule(tc.spec)
+		if tc.err && err == nil {
+			t.Fatalf("%s: have nil, want error", tc.spec)
+		}
+		if !tc.err && err != nil {
+			t.Fatalf("%s: have %v, want nil", tc.spec, err)
+		}
+	}
+}
+
+func TestEngineDetectAbsenceLayerWide(t *testing.T) {
+	ctx := context.Background()
+	for spec, want := range map[string]int{
+		`silence gt 30m`: 2,
+		`silence gt 30m { :center 42.9236075 -72.2792333 :radius 1km }`: 1,
+	} {
+		now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+		engine := New(WithClock(ClockFunc(func() time.Time { return now })))
+		if _, err := engine.AddRule(ctx, spec); err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		// far apart, only the layer is common
+		near := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+		far := makeDevice("c5vj26evvhfjvfseauog", 40.7127281, -74.0060152)
+		for _, device := range []*Device{near, far} {
+			if _, _, err := engine.Detect(ctx, device); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now = now.Add(31 * time.Minute)
+		events, err := engine.DetectAbsence(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := len(events); have != want {
+			t.Fatalf("%s: have %d, want %d events", spec, have, want)
+		}
+	}
+}
+
+func TestEngineDetectAbsenceUnknownDevice(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(WithClock(ClockFunc(func() time.Time { return now })))
+	rule, err := engine.AddRule(ctx, `silence(c5vj26evvhfjvfseauk0) gt 30m`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rule.RegionIDs()) != 0 {
+		t.Fatalf("have %d, want 0 regions", len(rule.RegionIDs()))
+	}
+	if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 40.7127281, -74.0060152)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(31 * time.Minute)
+	events, err := engine.DetectAbsence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("have %d, want 1 event", len(events))
+	}
+}
@@ -185,6 +185,34 @@ type (
 		Pos   Pos
 	}
 
+	// A SilenceLit represents the time since the last report of a device.
+	SilenceLit struct {
+		All bool
+		Ref []xid.ID
+		Pos Pos
+	}
+
+	// An OccupancyLit represents the number of devices inside objects.
+	OccupancyLit struct {
+		Object *ObjectLit
+		Pos    Pos
+	}
+
+	// A TrackLit represents a value computed from the track of a device,
+	// optionally limited to the window before the current report.
+	TrackLit struct {
+		Kind   Token
+		Window time.Duration
+		Pos    Pos
+	}
+
+	// A ConvoyLit represents the distances within a group of devices.
+	ConvoyLit struct {
+		Ref    []xid.ID
+		DurVal time.Duration
+		Pos    Pos
+	}
+
 	// A VarLit represents a variable literal.
 	VarLit struct {
 		Value Token
@@ -496,31 +524,85 @@ func (e *BaseLit) String() string {
 }
 
 func (e *DurationLit) String() string {
-	return "duration todo"
+	return e.Value.String()
+}
+
+func (e *OccupancyLit) String() string {
+	return fmt.Sprintf("%s(%s)", OCCUPANCY, e.Object)
+}
+
+func (e *TrackLit) String() string {
+	if e.Window > 0 {
+		return fmt.Sprintf("%s(%s)", e.Kind, e.Window)
+	}
+	return e.Kind.String()
+}
+
+func (e *ConvoyLit) String() string {
+	var sb strings.Builder
+	sb.WriteString(CONVOY.String())
+	sb.WriteString("(")
+	for i, ref := range e.Ref {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(`"`)
+		sb.WriteString(ref.String())
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(")")
+	if e.DurVal > 0 {
+		sb.WriteString(" :time after ")
+		sb.WriteString(e.DurVal.String())
+	}
+	return sb.String()
+}
+
+func (e *SilenceLit) String() string {
+	if len(e.Ref) == 0 {
+		return SILENCE.String()
+	}
+	var sb strings.Builder
+	sb.WriteString(SILENCE.String())
+	sb.WriteString("(")
+	for i, ref := range e.Ref {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(`"`)
+		sb.WriteString(ref.String())
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(")")
+	return sb.String()
 }
 
 func (e *IDLit) String() string {
 	return e.Value.String()
 }
 
-func (_ *ParenExpr) expr()   {}
-func (_ *BinaryExpr) expr()  {}
-func (_ *StringLit) expr()   {}
-func (_ *IntLit) expr()      {}
-func (_ *FloatLit) expr()    {}
-func (_ *VarLit) expr()      {}
-func (_ *BooleanLit) expr()  {}
-func (_ *DeviceLit) expr()   {}
-func (_ *ObjectLit) expr()   {}
-func (_ *IdentLit) expr()    {}
-func (_ *ListLit) expr()     {}
-func (_ *DevicesLit) expr()  {}
-func (_ *TimeLit) expr()     {}
-func (_ *PropExpr) expr()    {}
-func (_ *TriggerLit) expr()  {}
-func (_ *ResetLit) expr()    {}
-func (_ *PointLit) expr()    {}
-func (_ *DistanceLit) expr() {}
-func (_ *DurationLit) expr() {}
-func (_ *BaseLit) expr()     {}
-func (_ *IDLit) expr()       {}
+func (_ *ParenExpr) expr()    {}
+func (_ *BinaryExpr) expr()   {}
+func (_ *StringLit) expr()    {}
+func (_ *IntLit) expr()       {}
+func (_ *FloatLit) expr()     {}
+func (_ *VarLit) expr()       {}
+func (_ *BooleanLit) expr()   {}
+func (_ *DeviceLit) expr()    {}
+func (_ *ObjectLit) expr()    {}
+func (_ *IdentLit) expr()     {}
+func (_ *ListLit) expr()      {}
+func (_ *DevicesLit) expr()   {}
+func (_ *TimeLit) expr()      {}
+func (_ *PropExpr) expr()     {}
+func (_ *TriggerLit) expr()   {}
+func (_ *ResetLit) expr()     {}
+func (_ *PointLit) expr()     {}
+func (_ *DistanceLit) expr()  {}
+func (_ *DurationLit) expr()  {}
+func (_ *BaseLit) expr()      {}
+func (_ *IDLit) expr()        {}
+func (_ *SilenceLit) expr()   {}
+func (_ *OccupancyLit) expr() {}
+func (_ *ConvoyLit) expr()    {}
+func (_ *TrackLit) expr()     {}
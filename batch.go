@@ -0,0 +1,98 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var errDeviceNotSpecified = errors.New("spinix/engine: device not specified")
+
+type DetectResult struct {
+	Device *Device
+	Events []Event
+	Ok     bool
+	Err    error
+}
+
+type detectGroup struct {
+	region RegionID
+	index  []int
+}
+
+func (e *Engine) DetectBatch(ctx context.Context, devices []*Device) ([]DetectResult, error) {
+	results := make([]DetectResult, len(devices))
+	if len(devices) == 0 {
+		return results, nil
+	}
+	groups := groupByDevice(devices)
+	queue := make(chan *detectGroup)
+	var wg sync.WaitGroup
+	workers := e.workers
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range queue {
+				for _, i := range g.index {
+					results[i].Device = devices[i]
+					if err := ctx.Err(); err != nil {
+						results[i].Err = err
+						continue
+					}
+					results[i].Events, results[i].Ok, results[i].Err = e.Detect(ctx, devices[i])
+				}
+			}
+		}()
+	}
+loop:
+	for _, g := range groups {
+		select {
+		case <-ctx.Done():
+			break loop
+		case queue <- g:
+		}
+	}
+	close(queue)
+	wg.Wait()
+	for i := range results {
+		switch {
+		case devices[i] == nil:
+			results[i].Err = errDeviceNotSpecified
+		case results[i].Device == nil:
+			results[i].Device = devices[i]
+			results[i].Err = ctx.Err()
+		}
+	}
+	return results, ctx.Err()
+}
+
+// groupByDevice keeps the reports of one device in their original order
+// and sorts the groups by region so that neighbouring devices are evaluated together.
+func groupByDevice(devices []*Device) []*detectGroup {
+	index := make(map[DeviceID]*detectGroup)
+	groups := make([]*detectGroup, 0, len(devices))
+	for i, device := range devices {
+		if device == nil {
+			continue
+		}
+		g, ok := index[device.ID]
+		if !ok {
+			g = &detectGroup{
+				region: RegionFromLatLon(device.Latitude, device.Longitude, SmallRegionSize),
+				index:  make([]int, 0, 1),
+			}
+			index[device.ID] = g
+			groups = append(groups, g)
+		}
+		g.index = append(g.index, i)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].region < groups[j].region
+	})
+	return groups
+}
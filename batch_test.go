@@ -0,0 +1,100 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/xid"
+
+	"github.com/mmcloughlin/spherand"
+)
+
+func TestEngineDetectBatch(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithDetectWorkers(2))
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once }`); err != nil {
+		t.Fatal(err)
+	}
+	batch := []*Device{
+		makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333),
+		makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.3792333),
+		makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333),
+		nil,
+		makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.2792333),
+	}
+	results, err := engine.DetectBatch(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		events int
+		err    bool
+	}{
+		{events: 1},
+		{events: 0},
+		{events: 0},
+		{err: true},
+		{events: 1},
+	}
+	if have, want := len(results), len(want); have != want {
+		t.Fatalf("have %d, want %d results", have, want)
+	}
+	for i, res := range results {
+		if have, want := res.Err != nil, want[i].err; have != want {
+			t.Fatalf("result %d: have error %v, want error %v", i, res.Err, want)
+		}
+		if have, want := len(res.Events), want[i].events; have != want {
+			t.Fatalf("result %d: have %d, want %d events", i, have, want)
+		}
+		if res.Device != batch[i] {
+			t.Fatalf("result %d: device mismatch", i)
+		}
+	}
+}
+
+func makeBenchDetectEngine(b *testing.B, max int) (*Engine, []*Device) {
+	ctx := context.Background()
+	engine := New()
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :radius 20km }`); err != nil {
+		b.Fatal(err)
+	}
+	devices := make([]*Device, max)
+	for i := 0; i < max; i++ {
+		lat, lon := spherand.Geographical()
+		if i%2 == 0 {
+			lat, lon = 42.9236075, -72.2792333
+		}
+		devices[i] = &Device{ID: xid.New(), Latitude: lat, Longitude: lon}
+	}
+	return engine, devices
+}
+
+func BenchmarkEngineDetect(b *testing.B) {
+	ctx := context.Background()
+	engine, devices := makeBenchDetectEngine(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, device := range devices {
+			if _, _, err := engine.Detect(ctx, device); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEngineDetectBatch(b *testing.B) {
+	ctx := context.Background()
+	engine, devices := makeBenchDetectEngine(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.DetectBatch(ctx, devices); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
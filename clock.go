@@ -0,0 +1,62 @@
+package spinix
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+}
+
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+var SystemClock Clock = ClockFunc(time.Now)
+
+type TimeMode int
+
+const (
+	ProcessingTime TimeMode = 1
+	EventTime      TimeMode = 2
+)
+
+func (m TimeMode) String() string {
+	switch m {
+	case ProcessingTime:
+		return "processing"
+	case EventTime:
+		return "event"
+	default:
+		return "#?"
+	}
+}
+
+// LatePolicy tells the engine what to do with a report that is older than
+// the stored device. A late report never replaces the stored device
+// position, so Devices keeps the most recent fix whatever the policy.
+type LatePolicy int
+
+const (
+	// LateEvaluate evaluates the report like a regular one, the rule
+	// states move to the time of the late fix.
+	LateEvaluate LatePolicy = 1
+	// LateDrop ignores the report.
+	LateDrop LatePolicy = 2
+	// LateFlag evaluates the report against a copy of the rule states
+	// and flags the events as late. This is the default.
+	LateFlag LatePolicy = 3
+)
+
+func (p LatePolicy) String() string {
+	switch p {
+	case LateEvaluate:
+		return "evaluate"
+	case LateDrop:
+		return "drop"
+	case LateFlag:
+		return "flag"
+	default:
+		return "#?"
+	}
+}
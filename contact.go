@@ -0,0 +1,141 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mmadfox/geojson/geo"
+)
+
+// Contact is an interval during which another device stayed
+// within the contact distance of the traced device.
+type Contact struct {
+	DeviceID    DeviceID      `json:"deviceId"`
+	Start       int64         `json:"start"`
+	End         int64         `json:"end"`
+	Duration    time.Duration `json:"duration"`
+	MinDistance float64       `json:"minDistance"`
+	Position    Position      `json:"position"`
+	Other       Position      `json:"other"`
+}
+
+// Contacts returns the devices that were within meters of the device
+// between from and to. Positions are interpolated at the report times of
+// both devices, so the devices need not report at the same moments.
+// Position and Other are where both devices were at the closest approach.
+func (e *Engine) Contacts(ctx context.Context, id DeviceID, meters float64, from, to time.Time) ([]Contact, error) {
+	if e.refs.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if meters <= 0 {
+		return nil, fmt.Errorf("spinix/engine: invalid contact distance %f", meters)
+	}
+	scanner, ok := e.refs.devices.(deviceScanner)
+	if !ok {
+		return nil, fmt.Errorf("spinix/engine: %T does not support scanning", e.refs.devices)
+	}
+	track, err := e.refs.history.Track(ctx, id, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	if len(track) == 0 {
+		return nil, nil
+	}
+	var others []DeviceID
+	scanner.scan(func(d *Device) {
+		if d.ID != id {
+			others = append(others, d.ID)
+		}
+	})
+	var contacts []Contact
+	for _, other := range others {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		otherTrack, err := e.refs.history.Track(ctx, other, from.Unix(), to.Unix())
+		if err != nil {
+			if errors.Is(err, ErrHistoryNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		contacts = append(contacts, findContacts(other, track, otherTrack, meters)...)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		if contacts[i].Start == contacts[j].Start {
+			return contacts[i].DeviceID.Compare(contacts[j].DeviceID) < 0
+		}
+		return contacts[i].Start < contacts[j].Start
+	})
+	return contacts, nil
+}
+
+// findContacts walks the report times of both tracks over the period
+// they have in common.
+func findContacts(id DeviceID, a, b Track, meters float64) (contacts []Contact) {
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+	begin, end := a[0].DateTime, a[len(a)-1].DateTime
+	if b[0].DateTime > begin {
+		begin = b[0].DateTime
+	}
+	if last := b[len(b)-1].DateTime; last < end {
+		end = last
+	}
+	if begin > end {
+		return
+	}
+	current := -1
+	for _, dateTime := range reportTimes(a.between(begin, end), b.between(begin, end)) {
+		pa, pb := a.at(dateTime), b.at(dateTime)
+		distance := geo.DistanceTo(pa.Latitude, pa.Longitude, pb.Latitude, pb.Longitude)
+		if distance > meters {
+			current = -1
+			continue
+		}
+		if current < 0 {
+			contacts = append(contacts, Contact{
+				DeviceID:    id,
+				Start:       dateTime,
+				MinDistance: distance,
+				Position:    pa,
+				Other:       pb,
+			})
+			current = len(contacts) - 1
+		}
+		contact := &contacts[current]
+		contact.End = dateTime
+		contact.Duration = time.Duration(contact.End-contact.Start) * time.Second
+		if distance < contact.MinDistance {
+			contact.MinDistance = distance
+			contact.Position = pa
+			contact.Other = pb
+		}
+	}
+	return
+}
+
+// reportTimes merges the report times of both tracks.
+func reportTimes(a, b Track) []int64 {
+	times := make([]int64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var dateTime int64
+		switch {
+		case j == len(b) || i < len(a) && a[i].DateTime <= b[j].DateTime:
+			dateTime = a[i].DateTime
+			i++
+		default:
+			dateTime = b[j].DateTime
+			j++
+		}
+		if n := len(times); n == 0 || times[n-1] != dateTime {
+			times = append(times, dateTime)
+		}
+	}
+	return times
+}
@@ -0,0 +1,60 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngineContacts(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithHistory(NewMemoryHistory()), WithTimeMode(EventTime))
+	reports := []struct {
+		id       string
+		lat      float64
+		dateTime int64
+	}{
+		{"c5vj26evvhfjvfseauk0", 42.9200, 0},
+		{"c5vj26evvhfjvfseaukg", 42.9300, 30},
+		{"c5vj26evvhfjvfseauog", 42.9300, 30},
+		{"c5vj26evvhfjvfseauk0", 42.9200, 60},
+		{"c5vj26evvhfjvfseaukg", 42.9300, 90},
+		{"c5vj26evvhfjvfseauk0", 42.9200, 120},
+		{"c5vj26evvhfjvfseaukg", 42.9202, 150},
+		{"c5vj26evvhfjvfseauk0", 42.9200, 180},
+		{"c5vj26evvhfjvfseaukg", 42.9202, 210},
+		{"c5vj26evvhfjvfseauk0", 42.9200, 240},
+		{"c5vj26evvhfjvfseaukg", 42.9300, 270},
+		{"c5vj26evvhfjvfseauog", 42.9300, 270},
+		{"c5vj26evvhfjvfseauk0", 42.9200, 300},
+	}
+	for _, r := range reports {
+		device := makeDevice(r.id, r.lat, -72.27)
+		device.DateTime = r.dateTime
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contacts, err := engine.Contacts(ctx, did("c5vj26evvhfjvfseauk0"), 100, time.Unix(0, 0), time.Unix(300, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("have %d contacts, want 1", len(contacts))
+	}
+	contact := contacts[0]
+	if contact.DeviceID != did("c5vj26evvhfjvfseaukg") {
+		t.Fatalf("have %s, want c5vj26evvhfjvfseaukg", contact.DeviceID)
+	}
+	if contact.Start != 150 || contact.End != 210 || contact.Duration != time.Minute {
+		t.Fatalf("have %d..%d, want 150..210", contact.Start, contact.End)
+	}
+	if contact.MinDistance < 20 || contact.MinDistance > 25 {
+		t.Fatalf("have %f meters, want about 22", contact.MinDistance)
+	}
+
+	if _, err := New().Contacts(ctx, contact.DeviceID, 100, time.Unix(0, 0), time.Unix(300, 0)); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("have %v, want ErrHistoryDisabled", err)
+	}
+}
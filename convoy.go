@@ -0,0 +1,239 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mmadfox/geojson/geo"
+	"github.com/rs/xid"
+)
+
+const (
+	separatedKey = "convoy:separated"
+	togetherKey  = "convoy:together"
+
+	defaultMemberMaxAge = 10 * time.Minute
+)
+
+// convoyOp evaluates a group of devices on the report of any member
+// using the last known positions of the others.
+//
+//	convoy(a, b, c) gt 500                  - a member is farther than 500 m from every other member
+//	convoy(a, b, c) :time after 10m gt 500  - and stays so for 10 minutes
+//	convoy(a, b, c) :time after 30m lte 500 - all members move within 500 m of each other for 30 minutes
+//
+// Rules with only convoy conditions and no :center follow their members
+// wherever they report, with a :center only the reports in the area are
+// evaluated. Members whose last report is older than the :maxage of the
+// rule, 10 minutes by default, are left out.
+//
+//	convoy(a, b, c) gt 500 { :maxage 5m }
+type convoyOp struct {
+	ids    []xid.ID
+	after  int64
+	meters float64
+	op     Token
+	pos    Pos
+}
+
+func e2convoy(lhs *ConvoyLit, right Expr, op Token) (evaluater, error) {
+	node := convoyOp{
+		ids:   make([]xid.ID, len(lhs.Ref)),
+		after: int64(lhs.DurVal.Seconds()),
+		op:    op,
+		pos:   lhs.Pos,
+	}
+	copy(node.ids, lhs.Ref)
+	sort.Slice(node.ids, func(i, j int) bool {
+		return node.ids[i].Compare(node.ids[j]) < 0
+	})
+	switch rhs := right.(type) {
+	case *IntLit:
+		node.meters = float64(rhs.Value)
+	case *FloatLit:
+		node.meters = rhs.Value
+	default:
+		return nil, &InvalidExprError{
+			Left:  lhs,
+			Right: right,
+			Op:    op,
+			Pos:   lhs.Pos,
+			Msg:   fmt.Sprintf("got %s, expected [INT, FLOAT]", right),
+		}
+	}
+	switch op {
+	case GT, GTE, LT, LTE:
+		return node, nil
+	}
+	return nil, &InvalidExprError{
+		Left:  lhs,
+		Right: right,
+		Op:    op,
+		Pos:   lhs.Pos,
+		Msg:   fmt.Sprintf("got %s, expected [%s, %s, %s, %s]", op, GT, GTE, LT, LTE),
+	}
+}
+
+func (n convoyOp) refIDs() (refs map[xid.ID]Token) {
+	refs = make(map[xid.ID]Token, len(n.ids))
+	for _, id := range n.ids {
+		refs[id] = DEVICES
+	}
+	return
+}
+
+func (n convoyOp) evaluate(ctx context.Context, d *Device, state *State, r reference, props *specProps) (match Match, err error) {
+	match.Left.Keyword = CONVOY
+	match.Right.Keyword = FLOAT
+	match.Operator = n.op
+	match.Pos = n.pos
+	if d == nil || state == nil || !refExists(d.ID, n.ids) {
+		return
+	}
+	maxAge := defaultMemberMaxAge
+	if props != nil && props.maxAge > 0 {
+		maxAge = props.maxAge
+	}
+	members, err := n.members(ctx, d, state.now-int64(maxAge.Seconds()), r)
+	if err != nil || len(members) < 2 {
+		return
+	}
+	if n.op == GT || n.op == GTE {
+		match.Left.Refs, err = n.separated(ctx, members, state, r)
+		match.Ok = len(match.Left.Refs) > 0
+		return
+	}
+	together := true
+	for i := range members {
+		if members[i].Speed <= 0 || !n.compare(nearestMember(members, i)) {
+			together = false
+			break
+		}
+	}
+	if !n.hold(state, togetherKey, together) {
+		return
+	}
+	match.Ok = true
+	match.Left.Refs = make([]xid.ID, len(members))
+	for i := range members {
+		match.Left.Refs[i] = members[i].ID
+	}
+	return
+}
+
+// separated returns the members that are apart from the group long enough.
+// The separation time of a member is kept in its own state, so every
+// member report moves the timers of the whole group. Late reports and
+// explanations get isolated states from the spec and change nothing.
+func (n convoyOp) separated(ctx context.Context, members []*Device, state *State, r reference) (ids []xid.ID, err error) {
+	rid := state.RuleID()
+	for i, member := range members {
+		memberState := state
+		if member.ID != state.DeviceID() {
+			if memberState, err = r.states.Lookup(ctx, NewStateID(member.ID, rid)); err != nil {
+				if !errors.Is(err, ErrStateNotFound) {
+					return nil, err
+				}
+				if memberState, err = r.states.Make(ctx, NewStateID(member.ID, rid)); err != nil {
+					return nil, err
+				}
+			}
+			memberState.SetTime(state.now)
+		}
+		since := memberState.LastVisit(separatedKey)
+		if n.hold(memberState, separatedKey, n.compare(nearestMember(members, i))) {
+			ids = append(ids, member.ID)
+		}
+		if memberState != state && memberState.LastVisit(separatedKey) != since {
+			if err = r.states.Update(ctx, memberState); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, nil
+}
+
+// hold reports whether the condition has held for the configured time.
+func (n convoyOp) hold(state *State, key string, ok bool) bool {
+	if !ok {
+		state.SetLastVisit(key, 0)
+		return false
+	}
+	since := state.LastVisit(key)
+	if since == 0 || since > state.now {
+		since = state.now
+		state.SetLastVisit(key, since)
+	}
+	return state.now-since >= n.after
+}
+
+func (n convoyOp) compare(meters float64) bool {
+	switch n.op {
+	case GT:
+		return meters > n.meters
+	case GTE:
+		return meters >= n.meters
+	case LT:
+		return meters < n.meters
+	case LTE:
+		return meters <= n.meters
+	}
+	return false
+}
+
+// members returns the reporting device and the last known positions
+// of the other members in its layer reported since the given time.
+func (n convoyOp) members(ctx context.Context, d *Device, since int64, r reference) ([]*Device, error) {
+	members := make([]*Device, 0, len(n.ids))
+	for _, id := range n.ids {
+		if id == d.ID {
+			members = append(members, d)
+			continue
+		}
+		member, err := r.devices.Lookup(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrDeviceNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if member.Layer == d.Layer && member.DateTime >= since {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// isMemberBound reports whether the rule has convoy conditions and no
+// objects. Such rules need no coordinates.
+func (s *spec) isMemberBound() bool {
+	var convoy bool
+	for _, node := range s.nodes {
+		if _, ok := node.(convoyOp); ok {
+			convoy = true
+		}
+		if hasObjectRefs(node.refIDs()) {
+			return false
+		}
+	}
+	return convoy
+}
+
+// nearestMember returns the distance in meters from the i-th member
+// to the closest other member.
+func nearestMember(members []*Device, i int) float64 {
+	nearest := -1.0
+	for j := range members {
+		if i == j {
+			continue
+		}
+		meters := geo.DistanceTo(members[i].Latitude, members[i].Longitude, members[j].Latitude, members[j].Longitude)
+		if nearest < 0 || meters < nearest {
+			nearest = meters
+		}
+	}
+	return nearest
+}
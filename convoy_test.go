@@ -0,0 +1,236 @@
+package spinix
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEngineConvoy(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC).Unix()
+	members := []string{"c5vj26evvhfjvfseauk0", "c5vj26evvhfjvfseaukg", "c5vj26evvhfjvfseauog"}
+	testCases := []struct {
+		name      string
+		spec      string
+		lat       func(member int, minute int64) float64
+		firstTime int64
+		refs      int
+	}{
+		{
+			name: "separation",
+			spec: `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) :time after 10m gt 500 { :center 42.92 -72.27 :radius 20km }`,
+			lat: func(member int, minute int64) float64 {
+				if member == 2 && minute >= 3 {
+					return 42.9300
+				}
+				return 42.9200 + float64(member)*0.0005
+			},
+			firstTime: 780,
+			refs:      1,
+		},
+		{
+			name: "together",
+			spec: `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) :time after 2m lte 200 { :center 42.92 -72.27 :radius 20km }`,
+			lat: func(member int, minute int64) float64 {
+				return 42.9200 + float64(minute)*0.001 + float64(member)*0.0005
+			},
+			firstTime: 120,
+			refs:      3,
+		},
+		{
+			name: "anywhere",
+			spec: `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) :time after 2m lte 200`,
+			lat: func(member int, minute int64) float64 {
+				return 55.0000 + float64(minute)*0.001 + float64(member)*0.0005
+			},
+			firstTime: 120,
+			refs:      3,
+		},
+	}
+	for _, tc := range testCases {
+		engine := New(WithTimeMode(EventTime))
+		if _, err := engine.AddRule(ctx, tc.spec); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var events []Event
+		for minute := int64(0); minute <= 15; minute++ {
+			for i, id := range members {
+				device := makeDevice(id, tc.lat(i, minute), -72.27)
+				device.DateTime = start + minute*60
+				device.Speed = 30
+				res, _, err := engine.Detect(ctx, device)
+				if err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, res...)
+			}
+		}
+		if len(events) == 0 {
+			t.Fatalf("%s: no events", tc.name)
+		}
+		if have, want := events[0].DateTime-start, tc.firstTime; have != want {
+			t.Fatalf("%s: have first event at %d, want %d", tc.name, have, want)
+		}
+		if have, want := len(events[0].Match[0].Left.Refs), tc.refs; have != want {
+			t.Fatalf("%s: have %d devices, want %d", tc.name, have, want)
+		}
+	}
+}
+
+func TestEngineConvoyMaxAge(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC).Unix()
+	engine := New(WithTimeMode(EventTime))
+	if _, err := engine.AddRule(ctx, `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) gt 500 { :maxage 5m }`); err != nil {
+		t.Fatal(err)
+	}
+	detect := func(id string, lat float64, minute int64) []Event {
+		device := makeDevice(id, lat, -72.27)
+		device.DateTime = start + minute*60
+		events, _, err := engine.Detect(ctx, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	// the last report of the far member
+	detect("c5vj26evvhfjvfseauog", 42.9300, 0)
+	var last int64 = -1
+	for minute := int64(0); minute <= 15; minute++ {
+		events := detect("c5vj26evvhfjvfseauk0", 42.9200, minute)
+		events = append(events, detect("c5vj26evvhfjvfseaukg", 42.9205, minute)...)
+		if len(events) > 0 {
+			last = minute
+		}
+	}
+	if last != 5 {
+		t.Fatalf("have last event at minute %d, want 5", last)
+	}
+}
+
+func TestEngineConvoyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC).Unix()
+	members := []string{"c5vj26evvhfjvfseauk0", "c5vj26evvhfjvfseaukg", "c5vj26evvhfjvfseauog"}
+	reports := func(from int64) []*Device {
+		var devices []*Device
+		for minute := from; minute < from+10; minute++ {
+			for i, id := range members {
+				device := makeDevice(id, 42.9200+float64(i)*0.005, -72.27)
+				device.DateTime = start + minute*60
+				devices = append(devices, device)
+			}
+		}
+		return devices
+	}
+	engine := New(WithTimeMode(EventTime), WithDetectWorkers(3))
+	if _, err := engine.AddRule(ctx, `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) :time after 2m gt 300`); err != nil {
+		t.Fatal(err)
+	}
+	results, err := engine.DetectBatch(ctx, reports(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	in := make(chan *Device)
+	out := engine.Stream(ctx, in)
+	go func() {
+		defer close(in)
+		for _, device := range reports(10) {
+			in <- device
+		}
+	}()
+	for batch := range out {
+		if batch.Err != nil {
+			t.Fatal(batch.Err)
+		}
+	}
+}
+
+func TestEngineConvoyLateReport(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC).Unix()
+	members := []string{"c5vj26evvhfjvfseauk0", "c5vj26evvhfjvfseaukg", "c5vj26evvhfjvfseauog"}
+	engine := New(WithTimeMode(EventTime))
+	rule, err := engine.AddRule(ctx, `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg, c5vj26evvhfjvfseauog) :time after 10m gt 500`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detect := func(id string, lat float64, minute int64) {
+		device := makeDevice(id, lat, -72.27)
+		device.DateTime = start + minute*60
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots := func() []StateSnapshot {
+		list := make([]StateSnapshot, 0, len(members))
+		for _, id := range members {
+			state, err := engine.States().Lookup(ctx, NewStateID(did(id), rule.ID()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, state.Snapshot())
+		}
+		return list
+	}
+	for _, minute := range []int64{0, 5} {
+		detect(members[0], 42.9300, minute)
+		detect(members[1], 42.9200, minute)
+		detect(members[2], 42.9205, minute)
+	}
+	before := snapshots()
+	// a late report far away from the group
+	detect(members[1], 42.9600, 2)
+	if after := snapshots(); !reflect.DeepEqual(before, after) {
+		t.Fatalf("have %v, want unchanged member states %v", after, before)
+	}
+	explanation, err := engine.Explain(ctx, makeDevice(members[0], 42.9300, -72.27), rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanation.Nodes) != 1 || !explanation.Nodes[0].Evaluated {
+		t.Fatalf("have %+v, want evaluated convoy node", explanation)
+	}
+	if after := snapshots(); !reflect.DeepEqual(before, after) {
+		t.Fatalf("have %v, want unchanged member states %v", after, before)
+	}
+}
+
+func TestEngineConvoyArea(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC).Unix()
+	engine := New(WithTimeMode(EventTime))
+	rule, err := engine.AddRule(ctx, `convoy(c5vj26evvhfjvfseauk0, c5vj26evvhfjvfseaukg) gt 500 { :center 55.75 37.61 :radius 5km }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events int
+	for minute := int64(0); minute < 3; minute++ {
+		for i, id := range []string{"c5vj26evvhfjvfseauk0", "c5vj26evvhfjvfseaukg"} {
+			device := makeDevice(id, 42.9200+float64(i)*0.01, -72.27)
+			device.DateTime = start + minute*60
+			res, _, err := engine.Detect(ctx, device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events += len(res)
+		}
+	}
+	if events != 0 {
+		t.Fatalf("have %d, want 0 events outside of the rule area", events)
+	}
+	explanation, err := engine.Explain(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.92, -72.27), rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Reason != "device is outside of the rule area" {
+		t.Fatalf("have %q, want device outside of the rule area", explanation.Reason)
+	}
+}
@@ -0,0 +1,197 @@
+package spinix
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sync"
+	"time"
+)
+
+// eventIDBucket is the time bucket in seconds of event IDs, events of
+// one rule and device within a bucket share the ID.
+const eventIDBucket = 10
+
+// Deduper remembers event IDs. Seen reports whether the ID was marked
+// within the window, Mark records the ID once its event is published.
+// A shared implementation lets replicas that evaluate the same report
+// drop each other's events.
+type Deduper interface {
+	Seen(ctx context.Context, id string, now time.Time) (bool, error)
+	Mark(ctx context.Context, id string, now time.Time) error
+}
+
+func WithDeduper(d Deduper) Option {
+	return func(e *Engine) {
+		e.deduper = d
+	}
+}
+
+func WithDedupWindow(window time.Duration) Option {
+	return WithDeduper(NewMemoryDeduper(window))
+}
+
+// WithCorrelationWindow groups events of one device that follow each
+// other within the window, across rules. The CorrelationID of the events
+// is the ID of the first event of the group. An Incident, in contrast,
+// follows one rule of one device.
+func WithCorrelationWindow(window time.Duration) Option {
+	return func(e *Engine) {
+		e.correlator = &correlator{
+			window: int64(window.Seconds()),
+			index:  make(map[DeviceID]*correlationRef),
+		}
+	}
+}
+
+type memoryDeduper struct {
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+func NewMemoryDeduper(window time.Duration) Deduper {
+	return &memoryDeduper{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (d *memoryDeduper) Seen(_ context.Context, id string, now time.Time) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	at, ok := d.seen[id]
+	return ok && now.Sub(at) <= d.window, nil
+}
+
+func (d *memoryDeduper) Mark(_ context.Context, id string, now time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.pruned) > d.window {
+		for key, at := range d.seen {
+			if now.Sub(at) > d.window {
+				delete(d.seen, key)
+			}
+		}
+		d.pruned = now
+	}
+	d.seen[id] = now
+	return nil
+}
+
+type correlator struct {
+	window int64
+	mu     sync.Mutex
+	index  map[DeviceID]*correlationRef
+	pruned int64
+}
+
+type correlationRef struct {
+	id   string
+	last int64
+}
+
+func (c *correlator) correlate(events []Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range events {
+		event := &events[i]
+		if event.DateTime-c.pruned > c.window {
+			for id, ref := range c.index {
+				if event.DateTime-ref.last > c.window {
+					delete(c.index, id)
+				}
+			}
+			c.pruned = event.DateTime
+		}
+		ref, ok := c.index[event.Device.ID]
+		if !ok || event.DateTime-ref.last > c.window {
+			ref = &correlationRef{id: event.ID}
+			c.index[event.Device.ID] = ref
+		}
+		if event.DateTime > ref.last {
+			ref.last = event.DateTime
+		}
+		event.CorrelationID = ref.id
+	}
+}
+
+func (c *correlator) delete(id DeviceID) {
+	c.mu.Lock()
+	delete(c.index, id)
+	c.mu.Unlock()
+}
+
+// emit drops duplicates, correlates and publishes the events.
+func (e *Engine) emit(ctx context.Context, events []Event) ([]Event, error) {
+	if len(events) == 0 {
+		return events, nil
+	}
+	now := e.clock.Now()
+	if e.deduper != nil {
+		unique := events[:0]
+		batch := make(map[string]struct{}, len(events))
+		for _, event := range events {
+			if _, ok := batch[event.ID]; ok {
+				continue
+			}
+			seen, err := e.deduper.Seen(ctx, event.ID, now)
+			if err != nil {
+				return nil, err
+			}
+			if !seen {
+				batch[event.ID] = struct{}{}
+				unique = append(unique, event)
+			}
+		}
+		events = unique
+	}
+	if e.correlator != nil {
+		e.correlator.correlate(events)
+	}
+	// the report is processed, the sinks hand the events they could
+	// not accept to their error functions
+	if err := e.publish(ctx, events); err != nil || e.deduper == nil {
+		return events, nil
+	}
+	// events are marked once published, so a retried report
+	// delivers what a failed publish dropped
+	for _, event := range events {
+		// a failed mark only lets a duplicate through
+		_ = e.deduper.Mark(ctx, event.ID, now)
+	}
+	return events, nil
+}
+
+// makeEventID derives the event ID from what the event is about and the
+// time bucket, so that every node evaluating the same report produces
+// the same ID.
+func makeEventID(kind EventKind, did DeviceID, rid string, dateTime int64, matches []Match, extra ...int64) string {
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write(did.Bytes())
+	h.Write([]byte(rid))
+	writeInt(h, dateTime/eventIDBucket)
+	for _, m := range matches {
+		writeInt(h, int64(m.Left.Keyword), int64(m.Right.Keyword), int64(m.Operator), int64(m.Pos))
+		for _, ref := range m.Left.Refs {
+			h.Write(ref.Bytes())
+		}
+		for _, ref := range m.Right.Refs {
+			h.Write(ref.Bytes())
+		}
+	}
+	writeInt(h, extra...)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func writeInt(h hash.Hash, values ...int64) {
+	var buf [8]byte
+	for _, v := range values {
+		binary.BigEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+}
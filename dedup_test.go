@@ -0,0 +1,164 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineDedup(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	clock := WithClock(ClockFunc(func() time.Time { return now }))
+	deduper := NewMemoryDeduper(time.Minute)
+	spec := `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`
+	var (
+		nodes []*Engine
+		rid   RuleID
+	)
+	for i := 0; i < 2; i++ {
+		engine := New(clock, WithDeduper(deduper))
+		if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := NewRule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// replicas share rule IDs
+		if i == 0 {
+			rid = rule.id
+		}
+		rule.id = rid
+		if err := engine.AssignCoordsFromSpec(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Rules().Insert(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, engine)
+	}
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	device.DateTime = now.Unix()
+	events, ok, err := nodes[0].Detect(ctx, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || len(events) != 1 {
+		t.Fatalf("have %d events, want 1", len(events))
+	}
+	replica := *device
+	events, ok, err = nodes[1].Detect(ctx, &replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || len(events) != 0 {
+		t.Fatalf("have %d events, want 0", len(events))
+	}
+}
+
+func TestEngineCorrelation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithCorrelationWindow(5*time.Minute),
+	)
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{
+		`device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`,
+		`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) and speed gt 10`,
+	} {
+		if _, err := engine.AddRule(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	detect := func() []Event {
+		device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+		device.Speed = 20
+		events, _, err := engine.Detect(ctx, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("have %d events, want 2", len(events))
+		}
+		return events
+	}
+	first := detect()
+	if first[0].ID == first[1].ID {
+		t.Fatal("have equal event IDs for different rules")
+	}
+	if first[0].CorrelationID != first[1].CorrelationID {
+		t.Fatalf("have %s and %s, want one correlation", first[0].CorrelationID, first[1].CorrelationID)
+	}
+	now = now.Add(4 * time.Minute)
+	if next := detect(); next[0].CorrelationID != first[0].CorrelationID {
+		t.Fatalf("have %s, want %s", next[0].CorrelationID, first[0].CorrelationID)
+	}
+	now = now.Add(10 * time.Minute)
+	if next := detect(); next[0].CorrelationID == first[0].CorrelationID {
+		t.Fatal("have the same correlation after the window")
+	}
+}
+
+func TestEngineDedupFailedPublish(t *testing.T) {
+	ctx := context.Background()
+	deduper := NewMemoryDeduper(time.Minute)
+	var failed int
+	nodes := []*Engine{
+		New(WithDeduper(deduper), WithEventSink(NewChannelSink(make(chan Event)),
+			WithSinkError(func(events []Event, err error) {
+				failed += len(events)
+			}))),
+		New(WithDeduper(deduper)),
+	}
+	// the sink of the first node refuses the event
+	if err := nodes[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	device.DateTime = time.Now().Unix()
+	for i, engine := range nodes {
+		if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := NewRule(`device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rule.id = did("c5vj26evvhfjvfseaum0")
+		if err := engine.AssignCoordsFromSpec(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Rules().Insert(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+		replica := *device
+		events, _, err := engine.Detect(ctx, &replica)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("node %d: have %d events, want 1", i, len(events))
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("have %d failed, want 1", failed)
+	}
+}
+
+func TestMakeEventIDBucket(t *testing.T) {
+	id := did("c5vj26evvhfjvfseauk0")
+	a := makeEventID(EventRule, id, "rule", 1638352800, nil)
+	b := makeEventID(EventRule, id, "rule", 1638352800+eventIDBucket-1, nil)
+	c := makeEventID(EventRule, id, "rule", 1638352800+eventIDBucket, nil)
+	if a != b {
+		t.Fatal("have different IDs within one bucket")
+	}
+	if a == c {
+		t.Fatal("have equal IDs in different buckets")
+	}
+}
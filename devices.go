@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/rs/xid"
 
+	"github.com/mmadfox/geojson"
 	"github.com/mmadfox/geojson/geo"
+	"github.com/mmadfox/geojson/geometry"
 	"github.com/tidwall/rtree"
 )
 
@@ -22,6 +25,8 @@ type Devices interface {
 	Delete(ctx context.Context, id DeviceID) error
 	Each(ctx context.Context, rid RegionID, size RegionSize, fn DeviceIterFunc) error
 	Near(ctx context.Context, lat, lon, meters float64, fn DeviceIterFunc) error
+	Search(ctx context.Context, query geojson.Object, p SearchPredicate, fn DeviceIterFunc) error
+	Nearest(ctx context.Context, lat, lon float64, k int, filter DeviceFilterFunc) ([]*Device, error)
 }
 
 type Device struct {
@@ -112,10 +117,15 @@ func (d *devices) InsertOrReplace(_ context.Context, device *Device) (replaced b
 			device.Latitude,
 			device.Longitude,
 		)
-		if dist <= minDistMeters {
+		if dist <= minDistMeters && prevState.regionID == device.regionID {
+			// small moves swap the entry in place, the index must
+			// not keep the previous pointer around
+			if region, err := d.regionIndex.regionByID(device.regionID); err == nil {
+				region.replace(prevState, device)
+			}
 			d.hashIndex.set(device)
 			replaced = true
-			return
+			return replaced, nil
 		}
 		if prevState.RegionID() != device.RegionID() {
 			d.hashIndex.delete(device.ID)
@@ -151,6 +161,7 @@ func (d *devices) Delete(_ context.Context, id DeviceID) error {
 	if err != nil {
 		return err
 	}
+	d.hashIndex.delete(id)
 	region, err := d.regionIndex.regionByID(prevState.regionID)
 	// not found
 	if err != nil {
@@ -198,6 +209,99 @@ func (d *devices) Near(ctx context.Context, lat, lon, meters float64, fn DeviceI
 	return
 }
 
+func (d *devices) Search(ctx context.Context, query geojson.Object, p SearchPredicate, fn DeviceIterFunc) error {
+	if err := validateSearch(query, p); err != nil {
+		return err
+	}
+	bbox := query.Rect()
+	var found []*Device
+	for _, region := range d.regionIndex.list() {
+		region.mu.RLock()
+		region.index.Search(
+			[2]float64{bbox.Min.X, bbox.Min.Y},
+			[2]float64{bbox.Max.X, bbox.Max.Y},
+			func(min, max [2]float64, value interface{}) bool {
+				device := value.(*Device)
+				point := geojson.NewPoint(geometry.Point{X: device.Latitude, Y: device.Longitude})
+				if p.match(point, query) {
+					found = append(found, device)
+				}
+				return true
+			},
+		)
+		region.mu.RUnlock()
+	}
+	for _, device := range found {
+		if err := fn(ctx, device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *devices) Nearest(ctx context.Context, lat, lon float64, k int, filter DeviceFilterFunc) ([]*Device, error) {
+	if err := validateNearest(lat, lon, k); err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		device   *Device
+		distance float64
+	}
+	var found []candidate
+	total := d.regionIndex.size()
+	visited := 0
+	rings := newRegionRings(lat, lon, TinyRegionSize)
+	regions, _, ok := rings.next()
+	for ok && visited < total {
+		for _, rid := range regions {
+			region, err := d.regionIndex.regionByID(rid)
+			if err != nil {
+				continue
+			}
+			visited++
+			region.each(func(device *Device) bool {
+				if filter != nil && !filter(device) {
+					return true
+				}
+				found = append(found, candidate{
+					device:   device,
+					distance: geo.DistanceTo(lat, lon, device.Latitude, device.Longitude),
+				})
+				return true
+			})
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].distance < found[j].distance
+		})
+		var bound float64
+		regions, bound, ok = rings.next()
+		if len(found) >= k && found[k-1].distance <= bound {
+			break
+		}
+	}
+	if len(found) > k {
+		found = found[:k]
+	}
+	list := make([]*Device, len(found))
+	for i := 0; i < len(found); i++ {
+		list[i] = found[i].device
+	}
+	return list, nil
+}
+
+func (d *devices) scan(fn func(*Device)) {
+	for _, bucket := range d.hashIndex {
+		bucket.RLock()
+		for _, device := range bucket.index {
+			fn(device)
+		}
+		bucket.RUnlock()
+	}
+}
+
 type deviceRegionIndex struct {
 	regions map[RegionID]*deviceRegion
 	sync.RWMutex
@@ -223,6 +327,22 @@ func (ri *deviceRegionIndex) delete(rid RegionID) {
 	delete(ri.regions, rid)
 }
 
+func (ri *deviceRegionIndex) size() int {
+	ri.RLock()
+	defer ri.RUnlock()
+	return len(ri.regions)
+}
+
+func (ri *deviceRegionIndex) list() []*deviceRegion {
+	ri.RLock()
+	defer ri.RUnlock()
+	regions := make([]*deviceRegion, 0, len(ri.regions))
+	for _, region := range ri.regions {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
 func (ri *deviceRegionIndex) regionByID(rid RegionID) (*deviceRegion, error) {
 	ri.RLock()
 	defer ri.RUnlock()
@@ -283,6 +403,20 @@ func (r *deviceRegion) insert(device *Device) {
 	r.devices[device.ID] = device
 }
 
+func (r *deviceRegion) replace(prev, device *Device) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.index.Delete(
+		[2]float64{prev.Latitude, prev.Longitude},
+		[2]float64{prev.Latitude, prev.Longitude},
+		prev)
+	r.index.Insert(
+		[2]float64{device.Latitude, device.Longitude},
+		[2]float64{device.Latitude, device.Longitude},
+		device)
+	r.devices[device.ID] = device
+}
+
 func (r *deviceRegion) delete(device *Device) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/mmadfox/geojson/geo"
 	"github.com/rs/xid"
 
 	"github.com/mmcloughlin/spherand"
@@ -71,3 +72,77 @@ func BenchmarkDevicesNearby(b *testing.B) {
 		}
 	}
 }
+
+func TestDevicesSearch(t *testing.T) {
+	ctx := context.Background()
+	devices := NewMemoryDevices()
+	inside := &Device{ID: xid.New(), Latitude: 42.9236, Longitude: -72.2795}
+	for _, device := range []*Device{
+		inside,
+		{ID: xid.New(), Latitude: 42.9233, Longitude: -72.2789},
+		{ID: xid.New(), Latitude: 42.9312947, Longitude: -72.2845321},
+	} {
+		if _, err := devices.InsertOrReplace(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var found []DeviceID
+	if err := devices.Search(ctx, polyFromString(testPolyCoords), SearchWithin,
+		func(ctx context.Context, d *Device) error {
+			found = append(found, d.ID)
+			return nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0] != inside.ID {
+		t.Fatalf("have %v, want [%s] devices", found, inside.ID)
+	}
+}
+
+func TestDevicesNearest(t *testing.T) {
+	ctx := context.Background()
+	devices := NewMemoryDevices()
+	lat, lon := 42.9312947, -72.2845321
+	var want []DeviceID
+	for i, meters := range []float64{100, 5000, 90000, 250000, 1200000} {
+		dlat, dlon := geo.DestinationPoint(lat, lon, meters, float64(i*70))
+		device := &Device{ID: xid.New(), Latitude: dlat, Longitude: dlon, Status: 1}
+		if _, err := devices.InsertOrReplace(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, device.ID)
+		busy := &Device{ID: xid.New(), Latitude: dlat, Longitude: dlon, Status: 2}
+		if _, err := devices.InsertOrReplace(ctx, busy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	available := func(d *Device) bool {
+		return d.Status == 1
+	}
+	testCases := []struct {
+		k    int
+		want []DeviceID
+	}{
+		{k: 1, want: want[:1]},
+		{k: 3, want: want[:3]},
+		{k: 5, want: want},
+		{k: 10, want: want},
+	}
+	for _, tc := range testCases {
+		found, err := devices.Nearest(ctx, lat, lon, tc.k, available)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(tc.want) {
+			t.Fatalf("k=%d: have %d, want %d devices", tc.k, len(found), len(tc.want))
+		}
+		for i := range found {
+			if found[i].ID != tc.want[i] {
+				t.Fatalf("k=%d: have %s, want %s at %d", tc.k, found[i].ID, tc.want[i], i)
+			}
+		}
+	}
+	if _, err := devices.Nearest(ctx, lat, lon, 0, nil); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}
@@ -0,0 +1,421 @@
+package spinix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrStorageClosed = errors.New("spinix/disk: storage closed")
+	ErrStorageFailed = errors.New("spinix/disk: log write failed")
+)
+
+const (
+	walFilename      = "wal.log"
+	snapshotFilename = "snapshot.db"
+)
+
+type DiskOption func(*DiskStorage)
+
+func WithSyncWrites(enabled bool) DiskOption {
+	return func(s *DiskStorage) {
+		s.syncWrites = enabled
+	}
+}
+
+func WithSnapshotThreshold(n int) DiskOption {
+	return func(s *DiskStorage) {
+		s.snapshotThreshold = n
+	}
+}
+
+type DiskStorage struct {
+	dir               string
+	syncWrites        bool
+	snapshotThreshold int
+
+	mu     sync.RWMutex
+	walMu  sync.Mutex
+	wal    *walWriter
+	walErr error
+	closed bool
+
+	objects   *objects
+	rules     *rules
+	devices   *devices
+	states    *memoryState
+	layers    *layers
+	incidents *incidents
+}
+
+func OpenDiskStorage(dir string, opts ...DiskOption) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &DiskStorage{
+		dir:               dir,
+		syncWrites:        true,
+		snapshotThreshold: 10000,
+		objects:           NewMemoryObjects().(*objects),
+		rules:             NewMemoryRules().(*rules),
+		devices:           NewMemoryDevices().(*devices),
+		states:            NewMemoryState(),
+		layers:            NewMemoryLayers().(*layers),
+		incidents:         NewMemoryIncidents().(*incidents),
+	}
+	for _, f := range opts {
+		f(s)
+	}
+	if _, err := s.replay(filepath.Join(dir, snapshotFilename)); err != nil {
+		return nil, err
+	}
+	offset, err := s.replay(filepath.Join(dir, walFilename))
+	if err != nil {
+		return nil, err
+	}
+	s.wal, err = openWalWriter(filepath.Join(dir, walFilename), offset, s.syncWrites)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func WithDiskStorage(s *DiskStorage) Option {
+	return func(e *Engine) {
+		e.refs.objects = s.Objects()
+		e.refs.rules = s.Rules()
+		e.refs.devices = s.Devices()
+		e.refs.states = s.States()
+		e.refs.layers = s.Layers()
+		e.refs.incidents = s.Incidents()
+	}
+}
+
+func (s *DiskStorage) Objects() Objects {
+	return diskObjects{Objects: s.objects, s: s}
+}
+
+func (s *DiskStorage) Rules() Rules {
+	return diskRules{Rules: s.rules, s: s}
+}
+
+func (s *DiskStorage) Devices() Devices {
+	return diskDevices{Devices: s.devices, s: s}
+}
+
+func (s *DiskStorage) States() States {
+	return diskStates{States: s.states, s: s}
+}
+
+func (s *DiskStorage) Layers() Layers {
+	return diskLayers{Layers: s.layers, s: s}
+}
+
+func (s *DiskStorage) Incidents() Incidents {
+	return diskIncidents{Incidents: s.incidents, s: s}
+}
+
+func (s *DiskStorage) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+	return s.snapshot()
+}
+
+func (s *DiskStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.wal.close()
+}
+
+func (s *DiskStorage) snapshot() error {
+	filename := filepath.Join(s.dir, snapshotFilename)
+	tmp := filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := s.dump(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	if err := s.wal.reset(); err != nil {
+		return err
+	}
+	// the snapshot holds everything in memory, the log is in line again
+	s.walErr = nil
+	return nil
+}
+
+func (s *DiskStorage) dump(file *os.File) error {
+	return dumpRefs(context.Background(), s.memRefs(), func(kind recordKind, v interface{}) error {
+		data, err := encodeRecord(kind, opPut, v)
+		if err != nil {
+			return err
+		}
+		return writeWalRecord(file, data)
+	})
+}
+
+func (s *DiskStorage) memRefs() reference {
+	return reference{
+		objects:   s.objects,
+		rules:     s.rules,
+		devices:   s.devices,
+		states:    s.states,
+		layers:    s.layers,
+		incidents: s.incidents,
+	}
+}
+
+// commit applies the change in memory and appends it to the log under
+// one lock, so the log keeps the order of the changes in memory.
+// If the append fails memory is ahead of the log and the storage
+// refuses further changes until a snapshot brings them in line again.
+func (s *DiskStorage) commit(kind recordKind, op recordOp, v interface{}, apply func() error) error {
+	data, err := encodeRecord(kind, op, v)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrStorageClosed
+	}
+	s.walMu.Lock()
+	if s.walErr != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageFailed, s.walErr)
+	} else if err = apply(); err == nil {
+		if err = s.wal.append(data); err != nil {
+			s.walErr = err
+		}
+	}
+	compact := err == nil && s.snapshotThreshold > 0 && s.wal.n >= s.snapshotThreshold
+	s.walMu.Unlock()
+	s.mu.RUnlock()
+	if compact {
+		return s.compact()
+	}
+	return err
+}
+
+func (s *DiskStorage) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.wal.n < s.snapshotThreshold {
+		return nil
+	}
+	return s.snapshot()
+}
+
+func (s *DiskStorage) replay(filename string) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+	return readWalRecords(file, s.apply)
+}
+
+func (s *DiskStorage) apply(data []byte) error {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	return applyRecord(context.Background(), s.memRefs(), rec)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+type diskObjects struct {
+	Objects
+	s *DiskStorage
+}
+
+func (o diskObjects) Add(ctx context.Context, obj *GeoObject) error {
+	return o.s.commit(recordObject, opPut, makeObjectRecord(obj),
+		func() error { return o.Objects.Add(ctx, obj) })
+}
+
+func (o diskObjects) Update(ctx context.Context, obj *GeoObject) error {
+	return o.s.commit(recordObject, opPut, makeObjectRecord(obj),
+		func() error { return o.Objects.Update(ctx, obj) })
+}
+
+func (o diskObjects) Delete(ctx context.Context, id ObjectID) error {
+	return o.s.commit(recordObject, opDelete, objectRecord{ID: id},
+		func() error { return o.Objects.Delete(ctx, id) })
+}
+
+func (o diskObjects) DeleteLayer(ctx context.Context, lid LayerID) (n int, err error) {
+	err = o.Objects.EachLayer(ctx, lid, func(ctx context.Context, obj *GeoObject) error {
+		if err := o.Delete(ctx, obj.ID()); err != nil {
+			if errors.Is(err, ErrObjectNotFound) {
+				return nil
+			}
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (o diskObjects) scan(fn func(*GeoObject)) {
+	o.s.objects.scan(fn)
+}
+
+func (o diskObjects) at(lid LayerID, lat, lon float64, fn func(*GeoObject)) {
+	o.s.objects.at(lid, lat, lon, fn)
+}
+
+type diskRules struct {
+	Rules
+	s *DiskStorage
+}
+
+func (r diskRules) Insert(ctx context.Context, rule *Rule) error {
+	return r.s.commit(recordRule, opPut, rule.Snapshot(),
+		func() error { return r.Rules.Insert(ctx, rule) })
+}
+
+func (r diskRules) Update(ctx context.Context, rule *Rule) error {
+	return r.s.commit(recordRule, opPut, rule.Snapshot(),
+		func() error { return r.Rules.Update(ctx, rule) })
+}
+
+func (r diskRules) Delete(ctx context.Context, id RuleID) error {
+	return r.s.commit(recordRule, opDelete, RuleSnapshot{RuleID: id.String()},
+		func() error { return r.Rules.Delete(ctx, id) })
+}
+
+func (r diskRules) scan(fn func(*Rule)) {
+	r.s.rules.scan(fn)
+}
+
+type diskDevices struct {
+	Devices
+	s *DiskStorage
+}
+
+func (d diskDevices) InsertOrReplace(ctx context.Context, device *Device) (replaced bool, err error) {
+	err = d.s.commit(recordDevice, opPut, device,
+		func() (err error) {
+			replaced, err = d.Devices.InsertOrReplace(ctx, device)
+			return err
+		})
+	return replaced, err
+}
+
+func (d diskDevices) Delete(ctx context.Context, id DeviceID) error {
+	return d.s.commit(recordDevice, opDelete, Device{ID: id},
+		func() error { return d.Devices.Delete(ctx, id) })
+}
+
+func (d diskDevices) scan(fn func(*Device)) {
+	d.s.devices.scan(fn)
+}
+
+type diskStates struct {
+	States
+	s *DiskStorage
+}
+
+func (ds diskStates) Make(ctx context.Context, id StateID) (state *State, err error) {
+	err = ds.s.commit(recordState, opPut, NewState(id).Snapshot(),
+		func() (err error) {
+			state, err = ds.States.Make(ctx, id)
+			return err
+		})
+	return state, err
+}
+
+func (ds diskStates) Update(ctx context.Context, state *State) error {
+	return ds.s.commit(recordState, opPut, state.Snapshot(),
+		func() error { return ds.States.Update(ctx, state) })
+}
+
+func (ds diskStates) Remove(ctx context.Context, id StateID) error {
+	return ds.s.commit(recordState, opDelete, StateSnapshot{ID: id},
+		func() error { return ds.States.Remove(ctx, id) })
+}
+
+func (ds diskStates) RemoveByRule(ctx context.Context, rid RuleID) error {
+	return ds.s.commit(recordState, opDeleteByRule, StateSnapshot{ID: StateID{rid: rid}},
+		func() error { return ds.States.RemoveByRule(ctx, rid) })
+}
+
+func (ds diskStates) RemoveByDevice(ctx context.Context, did DeviceID) error {
+	return ds.s.commit(recordState, opDeleteByDevice, StateSnapshot{ID: StateID{did: did}},
+		func() error { return ds.States.RemoveByDevice(ctx, did) })
+}
+
+func (ds diskStates) scan(fn func(*State)) {
+	ds.s.states.scan(fn)
+}
+
+type diskLayers struct {
+	Layers
+	s *DiskStorage
+}
+
+func (l diskLayers) InsertOrReplace(ctx context.Context, layer *Layer) error {
+	return l.s.commit(recordLayer, opPut, layer,
+		func() error { return l.Layers.InsertOrReplace(ctx, layer) })
+}
+
+func (l diskLayers) Delete(ctx context.Context, id LayerID) error {
+	return l.s.commit(recordLayer, opDelete, Layer{ID: id},
+		func() error { return l.Layers.Delete(ctx, id) })
+}
+
+type diskIncidents struct {
+	Incidents
+	s *DiskStorage
+}
+
+func (di diskIncidents) InsertOrReplace(ctx context.Context, incident *Incident) error {
+	return di.s.commit(recordIncident, opPut, incident,
+		func() error { return di.Incidents.InsertOrReplace(ctx, incident) })
+}
+
+func (di diskIncidents) Delete(ctx context.Context, id StateID) error {
+	return di.s.commit(recordIncident, opDelete, Incident{ID: id},
+		func() error { return di.Incidents.Delete(ctx, id) })
+}
@@ -0,0 +1,235 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDiskStorageRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, snapshot := range []bool{false, true} {
+		name := "wal"
+		if snapshot {
+			name = "snapshot"
+		}
+		storage, err := OpenDiskStorage(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := New(WithDiskStorage(storage))
+		layer := NewLayer("yards")
+		if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+			t.Fatal(err)
+		}
+		object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+		if err := engine.Objects().Add(ctx, object); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+		events, _, err := engine.Detect(ctx, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("have %d, want 1 event", len(events))
+		}
+		if snapshot {
+			if err := storage.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := storage.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		storage, err = OpenDiskStorage(storage.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine = New(WithDiskStorage(storage))
+		if _, err := engine.Layers().Lookup(ctx, layer.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.Objects().Lookup(ctx, object.ID()); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := engine.Rules().Lookup(ctx, rule.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Center() != rule.Center() || len(restored.RegionIDs()) != len(rule.RegionIDs()) {
+			t.Fatalf("have %v, want %v rule center", restored.Center(), rule.Center())
+		}
+		if _, err := engine.Devices().Lookup(ctx, device.ID); err != nil {
+			t.Fatal(err)
+		}
+		events, _, err = engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 0 {
+			t.Fatalf("have %d, want 0 events after restore of the trigger state", len(events))
+		}
+		if err := engine.DeleteObject(ctx, object.ID()); !errors.Is(err, ErrReferenced) {
+			t.Fatalf("have %v, want ErrReferenced", err)
+		}
+		if err := storage.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiskStorageInvalidRules(t *testing.T) {
+	ctx := context.Background()
+	storage, err := OpenDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(WithDiskStorage(storage), WithDeletePolicy(DeleteInvalidate))
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteObject(ctx, object.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err = OpenDiskStorage(storage.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	engine = New(WithDiskStorage(storage), WithDeletePolicy(DeleteInvalidate))
+	if invalid := engine.InvalidRules(); len(invalid) != 1 || invalid[0] != rule.ID() {
+		t.Fatalf("have %v, want [%s]", invalid, rule.ID())
+	}
+	if err := engine.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := engine.InvalidRules(); len(invalid) != 0 {
+		t.Fatalf("have %v, want no invalid rules", invalid)
+	}
+}
+
+func TestDiskStorageTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storage, err := OpenDiskStorage(dir, WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := storage.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, walFilename), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{42, 0, 0, 0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	storage, err = OpenDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Objects().Lookup(ctx, object.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Objects().Delete(ctx, object.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	storage, err = OpenDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if _, err := storage.Objects().Lookup(ctx, object.ID()); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("have %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestDiskStorageConcurrentCommits(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storage, err := OpenDiskStorage(dir, WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				device := makeDevice("c5vj26evvhfjvfseauk0", 42.92+float64(i)*0.001, -72.27+float64(j)*0.001)
+				if _, err := storage.Devices().InsertOrReplace(ctx, device); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	want, err := storage.Devices().Lookup(ctx, did("c5vj26evvhfjvfseauk0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	storage, err = OpenDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	have, err := storage.Devices().Lookup(ctx, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have.Latitude != want.Latitude || have.Longitude != want.Longitude {
+		t.Fatalf("have %f %f, want %f %f after replay", have.Latitude, have.Longitude, want.Latitude, want.Longitude)
+	}
+}
+
+func TestDiskStorageFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	storage, err := OpenDiskStorage(t.TempDir(), WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = storage.wal.file.Close()
+	if err := storage.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err == nil {
+		t.Fatal("have nil, want append error")
+	}
+	err = storage.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaum0", testPolyCoords))
+	if !errors.Is(err, ErrStorageFailed) {
+		t.Fatalf("have %v, want ErrStorageFailed", err)
+	}
+	if _, err := storage.Objects().Lookup(ctx, did("c5vj26evvhfjvfseaum0")); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("have %v, want ErrObjectNotFound", err)
+	}
+}
@@ -2,7 +2,10 @@ package spinix
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/mmadfox/geojson/geometry"
@@ -17,21 +20,50 @@ type Detector interface {
 type Option func(*Engine)
 
 type Engine struct {
-	refs reference
+	refs         reference
+	refIndex     *refIndex
+	deletePolicy DeletePolicy
+	workers      int
+	streamBuffer int
+	clock        Clock
+	timeMode     TimeMode
+	latePolicy   LatePolicy
+	deviceTTL    time.Duration
+	trips        *tripDetector
+	sinks        []*sinkDispatcher
+	deduper      Deduper
+	correlator   *correlator
+	incidents    bool
+	closeOnce    sync.Once
 
 	beforeDetect []BeforeDetectFunc
 	afterDetect  []AfterDetectFunc
+	offline      []OfflineFunc
 }
 
 func New(opts ...Option) *Engine {
 	e := &Engine{
 		refs:         defaultRefs(),
+		refIndex:     newRefIndex(),
+		deletePolicy: DeleteReject,
+		workers:      runtime.NumCPU(),
+		streamBuffer: 64,
+		clock:        SystemClock,
+		timeMode:     ProcessingTime,
+		latePolicy:   LateFlag,
 		beforeDetect: []BeforeDetectFunc{},
 		afterDetect:  []AfterDetectFunc{},
 	}
 	for _, f := range opts {
 		f(e)
 	}
+	if s, ok := e.refs.rules.(ruleScanner); ok {
+		s.scan(e.refIndex.add)
+	}
+	// a failing objects storage shows up again on the first report
+	_ = e.invalidateDangling(context.Background())
+	_ = e.rebuildOccupancy(context.Background())
+	e.startSinks()
 	return e
 }
 
@@ -47,6 +79,48 @@ func WithDetectAfter(fn ...AfterDetectFunc) Option {
 	}
 }
 
+func WithDeletePolicy(p DeletePolicy) Option {
+	return func(e *Engine) {
+		e.deletePolicy = p
+	}
+}
+
+func WithDetectWorkers(n int) Option {
+	return func(e *Engine) {
+		if n > 0 {
+			e.workers = n
+		}
+	}
+}
+
+func WithStreamBuffer(size int) Option {
+	return func(e *Engine) {
+		if size >= 0 {
+			e.streamBuffer = size
+		}
+	}
+}
+
+func WithClock(c Clock) Option {
+	return func(e *Engine) {
+		if c != nil {
+			e.clock = c
+		}
+	}
+}
+
+func WithTimeMode(m TimeMode) Option {
+	return func(e *Engine) {
+		e.timeMode = m
+	}
+}
+
+func WithLatePolicy(p LatePolicy) Option {
+	return func(e *Engine) {
+		e.latePolicy = p
+	}
+}
+
 func WithObjectsStorage(o Objects) Option {
 	return func(e *Engine) {
 		e.refs.objects = o
@@ -65,6 +139,18 @@ func WithRulesStorage(r Rules) Option {
 	}
 }
 
+func WithLayersStorage(l Layers) Option {
+	return func(e *Engine) {
+		e.refs.layers = l
+	}
+}
+
+func WithHistory(h History) Option {
+	return func(e *Engine) {
+		e.refs.history = h
+	}
+}
+
 func WithStatesStorage(s States) Option {
 	return func(e *Engine) {
 		e.refs.states = s
@@ -72,29 +158,56 @@ func WithStatesStorage(s States) Option {
 }
 
 type Event struct {
-	ID       string       `json:"ID"`
-	Device   Device       `json:"device"`
-	DateTime int64        `json:"dateTime"`
-	Rule     RuleSnapshot `json:"rule"`
-	Match    []Match      `json:"match"`
+	ID            string       `json:"ID"`
+	Kind          EventKind    `json:"kind"`
+	Device        Device       `json:"device"`
+	DateTime      int64        `json:"dateTime"`
+	Rule          RuleSnapshot `json:"rule"`
+	Match         []Match      `json:"match"`
+	Late          bool         `json:"late,omitempty"`
+	CorrelationID string       `json:"correlationID,omitempty"`
+	Trip          *Trip        `json:"trip,omitempty"`
+	Stop          *Stop        `json:"stop,omitempty"`
 }
 
 func MakeEvent(d *Device, r *Rule, m []Match) Event {
+	return MakeEventAt(d, r, m, time.Now().Unix())
+}
+
+func MakeEventAt(d *Device, r *Rule, m []Match, dateTime int64) Event {
+	fixTime := dateTime
+	if d.DateTime > 0 {
+		fixTime = d.DateTime
+	}
 	event := Event{
-		ID:       xid.New().String(),
+		ID:       makeEventID(EventRule, d.ID, r.id.String(), fixTime, m),
+		Kind:     EventRule,
 		Device:   *d,
 		Rule:     r.Snapshot(),
-		DateTime: time.Now().Unix(),
+		DateTime: dateTime,
 		Match:    make([]Match, len(m)),
 	}
 	copy(event.Match, m)
 	return event
 }
 
+func (e *Engine) now(device *Device) int64 {
+	if e.timeMode == EventTime && device.DateTime > 0 {
+		return device.DateTime
+	}
+	return e.clock.Now().Unix()
+}
+
+// Objects returns the object store. Changes made through it follow the
+// engine rules: deletes apply the delete policy, updates re-index the
+// dependent rules and adds re-validate invalidated rules.
 func (e *Engine) Objects() Objects {
-	return e.refs.objects
+	return engineObjects{Objects: e.refs.objects, e: e}
 }
 
+// Rules returns the rule store. Rules inserted into the store directly
+// after New are not tracked by the reference index and are not protected
+// by the delete policy, add them with AddRule instead.
 func (e *Engine) Rules() Rules {
 	return e.refs.rules
 }
@@ -107,13 +220,31 @@ func (e *Engine) States() States {
 	return e.refs.states
 }
 
+func (e *Engine) Layers() Layers {
+	return engineLayers{Layers: e.refs.layers, e: e}
+}
+
+func (e *Engine) History() History {
+	return e.refs.history
+}
+
+type objectLookupFunc func(ctx context.Context, id ObjectID) (*GeoObject, error)
+
 func (e *Engine) AssignCoordsFromSpec(ctx context.Context, rule *Rule) (err error) {
+	return e.assignCoords(ctx, rule, e.refs.objects.Lookup)
+}
+
+func (e *Engine) assignCoords(ctx context.Context, rule *Rule, lookup objectLookupFunc) (err error) {
+	if rule.initRadius == 0 {
+		rule.initRadius = rule.spec.props.radius
+	}
 	if err = rule.spec.validate(); err != nil {
-		if err = e.calcCenter(ctx, rule); err != nil {
+		rule.autoCenter = true
+		if err = e.calcCenter(ctx, rule, lookup); err != nil {
 			return err
 		}
 	} else {
-		if err = e.expand(ctx, rule); err != nil {
+		if err = e.expand(ctx, rule, lookup); err != nil {
 			return err
 		}
 	}
@@ -125,23 +256,328 @@ func (e *Engine) AddRule(ctx context.Context, spec string) (*Rule, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, err := e.refs.layers.Lookup(ctx, rule.spec.props.layer); err != nil {
+		return nil, err
+	}
+	if err := e.validateOccupancy(rule); err != nil {
+		return nil, err
+	}
 	if err := e.AssignCoordsFromSpec(ctx, rule); err != nil {
 		return nil, err
 	}
 	if err := e.refs.rules.Insert(ctx, rule); err != nil {
 		return nil, err
 	}
+	e.refIndex.add(rule)
 	return rule, nil
 }
 
-func (e *Engine) calcCenter(ctx context.Context, rule *Rule) error {
+// AddObject adds the object and re-validates the rules that were
+// invalidated when an object with the same id was deleted.
+func (e *Engine) AddObject(ctx context.Context, o *GeoObject) error {
+	if err := e.refs.objects.Add(ctx, o); err != nil {
+		return err
+	}
+	return e.revalidate(ctx, o.ID())
+}
+
+// UpdateObject replaces the object geometry and re-indexes the rules
+// that reference it. The rules are prepared against the new geometry
+// first, so nothing is changed if any of them can not be placed.
+func (e *Engine) UpdateObject(ctx context.Context, o *GeoObject) error {
+	lookup := func(ctx context.Context, id ObjectID) (*GeoObject, error) {
+		if id == o.ID() {
+			return o, nil
+		}
+		return e.refs.objects.Lookup(ctx, id)
+	}
+	rules := e.refIndex.rulesByRef(o.ID())
+	next := make([]*Rule, 0, len(rules))
+	for _, rid := range rules {
+		rule, err := e.refs.rules.Lookup(ctx, rid)
+		if err != nil {
+			if errors.Is(err, ErrRuleNotFound) {
+				continue
+			}
+			return err
+		}
+		rule = rule.clone()
+		if rule.autoCenter {
+			rule.spec.props.center = geometry.Point{}
+		}
+		rule.spec.props.radius = rule.initRadius
+		if err := e.assignCoords(ctx, rule, lookup); err != nil {
+			return err
+		}
+		next = append(next, rule)
+	}
+	if err := e.refs.objects.Update(ctx, o); err != nil {
+		return err
+	}
+	if e.refs.occupancy != nil {
+		if err := e.refreshOccupancy(ctx, o); err != nil {
+			return err
+		}
+	}
+	for _, rule := range next {
+		if err := e.refs.rules.Update(ctx, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) RemoveRule(ctx context.Context, id RuleID) error {
+	if err := e.refs.rules.Delete(ctx, id); err != nil {
+		return err
+	}
+	e.refIndex.remove(id)
+	if err := e.refs.states.RemoveByRule(ctx, id); err != nil {
+		return err
+	}
+	return e.deleteRuleIncidents(ctx, id)
+}
+
+func (e *Engine) DeleteObject(ctx context.Context, id ObjectID) error {
+	rules := e.refIndex.rulesByRef(id)
+	if len(rules) > 0 && e.deletePolicy == DeleteReject {
+		return fmt.Errorf("%w - object %s used by %d rules", ErrReferenced, id, len(rules))
+	}
+	if err := e.refs.objects.Delete(ctx, id); err != nil {
+		return err
+	}
+	if e.refs.occupancy != nil {
+		e.refs.occupancy.deleteObject(id)
+	}
+	return e.applyDeletePolicy(ctx, rules)
+}
+
+func (e *Engine) DeleteDevice(ctx context.Context, id DeviceID) error {
+	rules := e.refIndex.rulesByRef(id)
+	if len(rules) > 0 && e.deletePolicy == DeleteReject {
+		return fmt.Errorf("%w - device %s used by %d rules", ErrReferenced, id, len(rules))
+	}
+	if err := e.refs.devices.Delete(ctx, id); err != nil {
+		return err
+	}
+	if err := e.refs.states.RemoveByDevice(ctx, id); err != nil {
+		return err
+	}
+	if err := e.deleteHistory(ctx, id); err != nil {
+		return err
+	}
+	if e.trips != nil {
+		e.trips.delete(id)
+	}
+	if e.correlator != nil {
+		e.correlator.delete(id)
+	}
+	if e.refs.occupancy != nil {
+		e.refs.occupancy.deleteDevice(id)
+	}
+	if err := e.deleteDeviceIncidents(ctx, id); err != nil {
+		return err
+	}
+	return e.applyDeletePolicy(ctx, rules)
+}
+
+// DeleteLayer deletes the objects of the layer and the layer itself.
+// The rules scoped to the layer are handled by the delete policy like
+// the rules that reference its objects.
+func (e *Engine) DeleteLayer(ctx context.Context, id LayerID) error {
+	if id == DefaultLayer {
+		_, err := e.deleteLayerObjects(ctx, id)
+		return err
+	}
+	if _, err := e.refs.layers.Lookup(ctx, id); err != nil {
+		return err
+	}
+	rules := e.refIndex.rulesByRef(id)
+	if len(rules) > 0 && e.deletePolicy == DeleteReject {
+		return fmt.Errorf("%w - layer %s used by %d rules", ErrReferenced, id, len(rules))
+	}
+	if _, err := e.deleteLayerObjects(ctx, id); err != nil {
+		return err
+	}
+	if err := e.refs.layers.Delete(ctx, id); err != nil {
+		return err
+	}
+	return e.applyDeletePolicy(ctx, rules)
+}
+
+// deleteLayerObjects checks every object of the layer against the
+// delete policy before deleting any of them.
+func (e *Engine) deleteLayerObjects(ctx context.Context, id LayerID) (int, error) {
+	var (
+		objects []ObjectID
+		rules   []RuleID
+	)
+	seen := make(map[RuleID]struct{})
+	if err := e.refs.objects.EachLayer(ctx, id, func(ctx context.Context, o *GeoObject) error {
+		objects = append(objects, o.ID())
+		for _, rid := range e.refIndex.rulesByRef(o.ID()) {
+			if _, ok := seen[rid]; !ok {
+				seen[rid] = struct{}{}
+				rules = append(rules, rid)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if len(rules) > 0 && e.deletePolicy == DeleteReject {
+		return 0, fmt.Errorf("%w - layer %s used by %d rules", ErrReferenced, id, len(rules))
+	}
+	n, err := e.refs.objects.DeleteLayer(ctx, id)
+	if err != nil {
+		return n, err
+	}
+	if e.refs.occupancy != nil {
+		for _, oid := range objects {
+			e.refs.occupancy.deleteObject(oid)
+		}
+	}
+	return n, e.applyDeletePolicy(ctx, rules)
+}
+
+type engineObjects struct {
+	Objects
+	e *Engine
+}
+
+func (o engineObjects) Add(ctx context.Context, obj *GeoObject) error {
+	return o.e.AddObject(ctx, obj)
+}
+
+func (o engineObjects) Update(ctx context.Context, obj *GeoObject) error {
+	return o.e.UpdateObject(ctx, obj)
+}
+
+func (o engineObjects) Delete(ctx context.Context, id ObjectID) error {
+	return o.e.DeleteObject(ctx, id)
+}
+
+func (o engineObjects) DeleteLayer(ctx context.Context, id LayerID) (int, error) {
+	return o.e.deleteLayerObjects(ctx, id)
+}
+
+type engineLayers struct {
+	Layers
+	e *Engine
+}
+
+func (l engineLayers) InsertOrReplace(ctx context.Context, layer *Layer) error {
+	if err := l.Layers.InsertOrReplace(ctx, layer); err != nil {
+		return err
+	}
+	return l.e.revalidate(ctx, layer.ID)
+}
+
+func (l engineLayers) Delete(ctx context.Context, id LayerID) error {
+	return l.e.DeleteLayer(ctx, id)
+}
+
+func (e *Engine) applyDeletePolicy(ctx context.Context, rules []RuleID) error {
+	for _, rid := range rules {
+		switch e.deletePolicy {
+		case DeleteCascade:
+			if err := e.RemoveRule(ctx, rid); err != nil && !errors.Is(err, ErrRuleNotFound) {
+				return err
+			}
+		case DeleteInvalidate:
+			e.refIndex.invalidate(rid)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) InvalidRules() []RuleID {
+	return e.refIndex.invalidRules()
+}
+
+func (e *Engine) DanglingRefs(ctx context.Context) ([]DanglingRef, error) {
+	var dangling []DanglingRef
+	for _, rid := range e.refIndex.ruleIDs() {
+		for refID, tok := range e.refIndex.refsByRule(rid) {
+			ok, err := e.refExists(ctx, refID, tok)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
+			dangling = append(dangling, DanglingRef{
+				RuleID: rid,
+				RefID:  refID,
+				Kind:   tok,
+			})
+		}
+	}
+	return dangling, nil
+}
+
+// invalidateDangling marks the rules again whose objects or layers are
+// gone, the marks left by DeleteInvalidate are not stored. Device refs
+// are skipped, a device named by a rule may not have reported yet.
+func (e *Engine) invalidateDangling(ctx context.Context) error {
+	dangling, err := e.DanglingRefs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ref := range dangling {
+		if ref.Kind != DEVICES {
+			e.refIndex.invalidate(ref.RuleID)
+		}
+	}
+	return nil
+}
+
+// revalidate marks the invalidated rules that reference refID as valid
+// again once all their references exist.
+func (e *Engine) revalidate(ctx context.Context, refID xid.ID) error {
+next:
+	for _, rid := range e.refIndex.invalidByRef(refID) {
+		for ref, tok := range e.refIndex.refsByRule(rid) {
+			ok, err := e.refExists(ctx, ref, tok)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue next
+			}
+		}
+		e.refIndex.validate(rid)
+	}
+	return nil
+}
+
+func (e *Engine) refExists(ctx context.Context, refID xid.ID, tok Token) (bool, error) {
+	var err error
+	switch tok {
+	case LAYER:
+		if _, err = e.refs.layers.Lookup(ctx, refID); errors.Is(err, ErrLayerNotFound) {
+			return false, nil
+		}
+	case DEVICES:
+		if _, err = e.refs.devices.Lookup(ctx, refID); errors.Is(err, ErrDeviceNotFound) {
+			return false, nil
+		}
+	default:
+		if _, err = e.refs.objects.Lookup(ctx, refID); errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+	}
+	return err == nil, err
+}
+
+func (e *Engine) calcCenter(ctx context.Context, rule *Rule, lookup objectLookupFunc) error {
 	refs := rule.RefIDs()
 	var bbox geometry.Rect
 	for refID, tok := range refs {
 		if !isObjectToken(tok) || tok == DEVICES {
 			continue
 		}
-		object, err := e.refs.objects.Lookup(ctx, refID)
+		object, err := lookup(ctx, refID)
 		if err != nil {
 			return fmt.Errorf("%w - failed to add rule [%s]", err, rule.specStr)
 		}
@@ -151,13 +587,13 @@ func (e *Engine) calcCenter(ctx context.Context, rule *Rule) error {
 	return rule.calc()
 }
 
-func (e *Engine) expand(ctx context.Context, rule *Rule) error {
+func (e *Engine) expand(ctx context.Context, rule *Rule, lookup objectLookupFunc) error {
 	if err := rule.spec.validate(); err != nil {
 		return err
 	}
 	refs := rule.RefIDs()
 	var ok bool
-	if refs != nil {
+	if hasObjectRefs(refs) {
 		for i := 0; i < 10; i++ {
 			var bbox geometry.Rect
 			circle := circleFromRule(rule)
@@ -165,7 +601,7 @@ func (e *Engine) expand(ctx context.Context, rule *Rule) error {
 				if !isObjectToken(tok) || tok == DEVICES {
 					continue
 				}
-				object, err := e.refs.objects.Lookup(ctx, refID)
+				object, err := lookup(ctx, refID)
 				if err != nil {
 					return fmt.Errorf("%w - failed to add rule [%s]", err, rule.specStr)
 				}
@@ -187,43 +623,168 @@ func (e *Engine) expand(ctx context.Context, rule *Rule) error {
 	return nil
 }
 
+func hasObjectRefs(refs map[xid.ID]Token) bool {
+	for _, tok := range refs {
+		if isObjectToken(tok) && tok != DEVICES {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Engine) Detect(ctx context.Context, device *Device) (events []Event, ok bool, err error) {
+	late, err := e.isLate(ctx, device)
+	if err != nil {
+		return nil, false, err
+	}
+	if late && e.latePolicy == LateDrop {
+		return nil, false, nil
+	}
 	device.DetectRegion()
-	err = e.refs.rules.Walk(ctx, device.Latitude, device.Longitude,
-		func(ctx context.Context, rule *Rule, err error) error {
-			if err != nil {
-				return err
-			}
-			for _, beforeFunc := range e.beforeDetect {
-				if ok := beforeFunc(device, rule); ok {
-					continue
-				}
-			}
-			match, status, err := rule.spec.evaluate(ctx, rule.id, device, e.refs)
-			if err != nil {
-				return err
+	env := evalEnv{
+		now:      e.now(device),
+		readOnly: late && e.latePolicy == LateFlag,
+	}
+	// late fixes are still part of the track, history keeps them in order
+	if e.refs.history != nil {
+		fix := *device
+		if fix.DateTime <= 0 {
+			fix.DateTime = env.now
+		}
+		if err = e.refs.history.Append(ctx, &fix); err != nil {
+			return nil, false, err
+		}
+	}
+	if e.refs.occupancy != nil && !late {
+		if err = e.updateOccupancy(ctx, device); err != nil {
+			return nil, false, err
+		}
+	}
+	trackIncidents := e.incidents && !late
+	var (
+		matched map[RuleID]string
+		held    map[RuleID]struct{}
+	)
+	if trackIncidents {
+		matched = make(map[RuleID]string)
+		held = make(map[RuleID]struct{})
+	}
+	detectRule := func(ctx context.Context, rule *Rule, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.refIndex.isInvalid(rule.ID()) || rule.spec.isAbsence {
+			return nil
+		}
+		for _, beforeFunc := range e.beforeDetect {
+			if ok := beforeFunc(device, rule); ok {
+				continue
 			}
-			if status {
-				ok = true
-				if events == nil {
-					events = make([]Event, 0, 2)
-				}
-				events = append(events, MakeEvent(device, rule, match))
+		}
+		ruleEnv := env
+		var holding bool
+		if trackIncidents {
+			ruleEnv.held = &holding
+		}
+		match, status, err := rule.spec.evaluate(ctx, rule.id, device, ruleEnv, e.refs)
+		if err != nil {
+			return err
+		}
+		if holding {
+			held[rule.id] = struct{}{}
+		}
+		if status {
+			ok = true
+			if events == nil {
+				events = make([]Event, 0, 2)
 			}
-			for _, afterFunc := range e.afterDetect {
-				afterFunc(device, rule, ok, events)
+			event := MakeEventAt(device, rule, match, env.now)
+			event.Late = late
+			events = append(events, event)
+			if trackIncidents {
+				matched[rule.id] = event.ID
 			}
-			return nil
-		})
+		}
+		for _, afterFunc := range e.afterDetect {
+			afterFunc(device, rule, ok, events)
+		}
+		return nil
+	}
+	err = e.refs.rules.Walk(ctx, device.Latitude, device.Longitude, detectRule)
 	if err == nil {
-		if _, err = e.refs.devices.InsertOrReplace(ctx, device); err != nil {
+		err = e.walkMemberRules(ctx, device.ID, detectRule)
+	}
+	if err == nil && trackIncidents {
+		if err = e.trackIncidents(ctx, device.ID, matched, held, env.now); err != nil {
+			return nil, false, err
+		}
+	}
+	if err == nil && !late && e.trips != nil {
+		var segments []Event
+		if segments, err = e.detectTrip(ctx, device, env.now); err != nil {
+			return nil, false, err
+		}
+		if len(segments) > 0 {
+			ok = true
+			events = append(events, segments...)
+		}
+	}
+	if err == nil && !late {
+		stored := *device
+		if stored.DateTime <= 0 {
+			stored.DateTime = env.now
+		}
+		if _, err = e.refs.devices.InsertOrReplace(ctx, &stored); err != nil {
+			return nil, false, err
+		}
+		if err = e.revalidate(ctx, device.ID); err != nil {
 			return nil, false, err
 		}
 	}
+	if err == nil {
+		events, err = e.emit(ctx, events)
+		ok = len(events) > 0
+	}
 	device.ResetRegion()
 	return
 }
 
+// walkMemberRules calls fn for the rules that follow the device wherever
+// it reports. They have no regions, Walk does not find them.
+func (e *Engine) walkMemberRules(ctx context.Context, did DeviceID, fn RuleIterFunc) error {
+	for _, rid := range e.refIndex.rulesByRef(did) {
+		rule, err := e.refs.rules.Lookup(ctx, rid)
+		if err != nil {
+			if errors.Is(err, ErrRuleNotFound) {
+				continue
+			}
+			return err
+		}
+		// rules with an area are found by region
+		if !rule.spec.isMemberBound() || rule.spec.hasArea() {
+			continue
+		}
+		if err := fn(ctx, rule, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) isLate(ctx context.Context, device *Device) (bool, error) {
+	if device.DateTime <= 0 {
+		return false, nil
+	}
+	prev, err := e.refs.devices.Lookup(ctx, device.ID)
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return prev.DateTime > device.DateTime, nil
+}
+
 func (e *Engine) calcBounding(a, b geometry.Rect) (bbox geometry.Rect) {
 	if a.Min.X == 0 && a.Min.Y == 0 &&
 		a.Max.X == 0 && a.Max.Y == 0 {
@@ -1,8 +1,12 @@
 package spinix
 
 import (
+	"context"
+	"errors"
 	"strconv"
 	"strings"
+	"testing"
+	"time"
 
 	"github.com/mmadfox/geojson"
 
@@ -208,6 +212,334 @@ import (
 //	}
 //}
 //
+
+func TestEngineDeleteObjectPolicy(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		policy   DeletePolicy
+		err      error
+		rules    int
+		invalid  int
+		dangling int
+		events   int
+	}{
+		{policy: DeleteReject, err: ErrReferenced, rules: 1, events: 1},
+		{policy: DeleteCascade, rules: 0},
+		{policy: DeleteInvalidate, rules: 1, invalid: 1, dangling: 1},
+	}
+	for _, tc := range testCases {
+		engine := New(WithDeletePolicy(tc.policy))
+		object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+		if err := engine.Objects().Add(ctx, object); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = engine.DeleteObject(ctx, object.ID())
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: engine.DeleteObject() => %v, want %v", tc.policy, err, tc.err)
+		}
+		var rules int
+		if _, err := engine.Rules().Lookup(ctx, rule.ID()); err == nil {
+			rules++
+		}
+		if have, want := rules, tc.rules; have != want {
+			t.Fatalf("%s: have %d, want %d rules", tc.policy, have, want)
+		}
+		if have, want := len(engine.InvalidRules()), tc.invalid; have != want {
+			t.Fatalf("%s: have %d, want %d invalid rules", tc.policy, have, want)
+		}
+		dangling, err := engine.DanglingRefs(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(dangling), tc.dangling; have != want {
+			t.Fatalf("%s: have %d, want %d dangling refs", tc.policy, have, want)
+		}
+		events, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(events), tc.events; have != want {
+			t.Fatalf("%s: have %d, want %d events", tc.policy, have, want)
+		}
+	}
+}
+
+func TestEngineAddObjectRevalidatesRules(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithDeletePolicy(DeleteInvalidate))
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.AddObject(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteObject(ctx, object.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(engine.InvalidRules()), 1; have != want {
+		t.Fatalf("have %d, want %d invalid rules", have, want)
+	}
+	if err := engine.AddObject(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(engine.InvalidRules()), 0; have != want {
+		t.Fatalf("have %d, want %d invalid rules", have, want)
+	}
+	events, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(events), 1; have != want {
+		t.Fatalf("have %d, want %d events", have, want)
+	}
+}
+
+func TestEngineUpdateObjectKeepsStateOnError(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithDeletePolicy(DeleteInvalidate))
+	first := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	second := str2obj("c5vj26evvhfjvfseaum0", testPolyCoords)
+	for _, object := range []*GeoObject{first, second} {
+		if err := engine.AddObject(ctx, object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg, c5vj26evvhfjvfseaum0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteObject(ctx, second.ID()); err != nil {
+		t.Fatal(err)
+	}
+	moved := NewGeoObject(first.ID(), DefaultLayer, polyFromString(`
+-72.3800060, 42.9238589
+-72.3802743, 42.9231989
+-72.3790616, 42.9232461
+-72.3800060, 42.9238589
+`))
+	if err := engine.UpdateObject(ctx, moved); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("have %v, want ErrObjectNotFound", err)
+	}
+	stored, err := engine.Objects().Lookup(ctx, first.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Center() != first.Center() {
+		t.Fatal("object updated although rules were not re-indexed")
+	}
+	current, err := engine.Rules().Lookup(ctx, rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Center() != rule.Center() {
+		t.Fatal("rule updated")
+	}
+}
+
+func TestEngineDetectUpdatesRulesFromHooks(t *testing.T) {
+	ctx := context.Background()
+	var engine *Engine
+	engine = New(WithDetectAfter(func(d *Device, rule *Rule, ok bool, events []Event) {
+		// must not deadlock on the rules lock held by the walk
+		if err := engine.Rules().Update(ctx, rule); err != nil {
+			t.Error(err)
+		}
+	}))
+	if err := engine.AddObject(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("detect blocked by rule update")
+	}
+}
+
+func TestEngineUpdateObjectReindexRules(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := str2obj("c5vj26evvhfjvfseaulg", `
+-72.3800060, 42.9238589
+-72.3802743, 42.9231989
+-72.3790616, 42.9232461
+-72.3787397, 42.9239689
+-72.3799953, 42.9238746
+-72.3800060, 42.9238589
+`)
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.3795333)
+	events, _, err := engine.Detect(ctx, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(events), 0; have != want {
+		t.Fatalf("have %d, want %d events", have, want)
+	}
+	if err := engine.UpdateObject(ctx, moved); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := engine.Rules().Lookup(ctx, rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Center() == rule.Center() {
+		t.Fatalf("rule center %v not changed", updated.Center())
+	}
+	events, _, err = engine.Detect(ctx, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(events), 1; have != want {
+		t.Fatalf("have %d, want %d events", have, want)
+	}
+}
+
+func TestEngineEventTimeMode(t *testing.T) {
+	ctx := context.Background()
+	wallClock := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		mode   TimeMode
+		events []int64
+	}{
+		{
+			mode:   EventTime,
+			events: []int64{start.Unix(), start.Add(2 * time.Hour).Unix()},
+		},
+		{
+			mode:   ProcessingTime,
+			events: []int64{wallClock.Unix()},
+		},
+	}
+	for _, tc := range testCases {
+		engine := New(
+			WithTimeMode(tc.mode),
+			WithClock(ClockFunc(func() time.Time { return wallClock })),
+		)
+		if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.AddRule(ctx,
+			`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once :reset after 1h }`); err != nil {
+			t.Fatal(err)
+		}
+		var events []int64
+		for _, offset := range []time.Duration{0, 30 * time.Minute, 2 * time.Hour} {
+			device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+			device.DateTime = start.Add(offset).Unix()
+			res, _, err := engine.Detect(ctx, device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, event := range res {
+				events = append(events, event.DateTime)
+			}
+		}
+		if have, want := len(events), len(tc.events); have != want {
+			t.Fatalf("%s: have %d, want %d events", tc.mode, have, want)
+		}
+		for i := range events {
+			if have, want := events[i], tc.events[i]; have != want {
+				t.Fatalf("%s: have %d, want %d event time", tc.mode, have, want)
+			}
+		}
+	}
+}
+
+func TestEngineLatePolicy(t *testing.T) {
+	ctx := context.Background()
+	current := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC).Unix()
+	late := current - 3600
+	testCases := []struct {
+		policy   LatePolicy
+		events   int
+		lastSeen int64
+	}{
+		{policy: LateDrop, events: 0, lastSeen: current},
+		{policy: LateEvaluate, events: 1, lastSeen: late},
+		{policy: LateFlag, events: 1, lastSeen: current},
+		{events: 1, lastSeen: current},
+	}
+	for _, tc := range testCases {
+		opts := []Option{WithTimeMode(EventTime)}
+		if tc.policy > 0 {
+			opts = append(opts, WithLatePolicy(tc.policy))
+		}
+		engine := New(opts...)
+		if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :reset after 24h }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+		device.DateTime = current
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+		lateDevice := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+		lateDevice.DateTime = late
+		events, _, err := engine.Detect(ctx, lateDevice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(events), tc.events; have != want {
+			t.Fatalf("%s: have %d, want %d events", tc.policy, have, want)
+		}
+		for _, event := range events {
+			if !event.Late {
+				t.Fatalf("%s: have event without late flag", tc.policy)
+			}
+		}
+		stored, err := engine.Devices().Lookup(ctx, device.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := stored.DateTime, current; have != want {
+			t.Fatalf("%s: have %d, want %d stored dateTime", tc.policy, have, want)
+		}
+		state, err := engine.States().Lookup(ctx, StateID{did: device.ID, rid: rule.ID()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := state.LastSeenTime(), tc.lastSeen; have != want {
+			t.Fatalf("%s: have %d, want %d state lastSeenTime", tc.policy, have, want)
+		}
+	}
+}
+
+const testPolyCoords = `
+-72.2800060, 42.9238589
+-72.2802743, 42.9231989
+-72.2790616, 42.9232461
+-72.2787397, 42.9239689
+-72.2799953, 42.9238746
+-72.2800060, 42.9238589
+`
+
 func pointsFromString(s string) []geometry.Point {
 	lines := strings.Split(s, "\n")
 	res := make([]geometry.Point, 0)
@@ -251,3 +583,116 @@ func collectionFromString(sets ...string) *geojson.GeometryCollection {
 	}
 	return geojson.NewGeometryCollection(objects)
 }
+
+func TestEngineLayers(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	layer := NewLayer("warehouses")
+	layer.Owner = "logistics"
+	spec := `device INTERSECTS polygon(@) { :center 42.9314328 -72.2812945 :radius 5km :layer ` + layer.ID.String() + ` }`
+	if _, err := engine.AddRule(ctx, spec); !errors.Is(err, ErrLayerNotFound) {
+		t.Fatalf("have %v, want ErrLayerNotFound", err)
+	}
+	if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Objects().Add(ctx, NewGeoObjectWithID(layer.ID, polyFromString(testPolyCoords))); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteLayer(ctx, layer.ID); !errors.Is(err, ErrReferenced) {
+		t.Fatalf("have %v, want ErrReferenced", err)
+	}
+	if err := engine.RemoveRule(ctx, rule.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteLayer(ctx, layer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := engine.Objects().Count(ctx, layer.ID); count != 0 {
+		t.Fatalf("have %d, want 0 objects", count)
+	}
+	if _, err := engine.Layers().Lookup(ctx, layer.ID); !errors.Is(err, ErrLayerNotFound) {
+		t.Fatalf("have %v, want ErrLayerNotFound", err)
+	}
+}
+
+func TestEngineDeleteLayerPolicy(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	layer := NewLayer("warehouses")
+	if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c5vj26evvhfjvfseaulg", "c5vj26evvhfjvfseaum0", "c5vj26evvhfjvfseaumg"} {
+		if err := engine.Objects().Add(ctx, NewGeoObject(did(id), layer.ID, polyFromString(testPolyCoords))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spec := `device INTERSECTS polygon(c5vj26evvhfjvfseaum0) { :layer ` + layer.ID.String() + ` }`
+	if _, err := engine.AddRule(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteLayer(ctx, layer.ID); !errors.Is(err, ErrReferenced) {
+		t.Fatalf("have %v, want ErrReferenced", err)
+	}
+	if _, err := engine.Objects().DeleteLayer(ctx, layer.ID); !errors.Is(err, ErrReferenced) {
+		t.Fatalf("have %v, want ErrReferenced", err)
+	}
+	if count, _ := engine.Objects().Count(ctx, layer.ID); count != 3 {
+		t.Fatalf("have %d, want 3 objects", count)
+	}
+}
+
+func TestEngineDeleteLayerScopedRules(t *testing.T) {
+	ctx := context.Background()
+	spec := func(layer *Layer) string {
+		return `device INTERSECTS polygon(@) { :center 42.9314328 -72.2812945 :radius 5km :layer ` + layer.ID.String() + ` }`
+	}
+	engine := New(WithDeletePolicy(DeleteInvalidate))
+	layer := NewLayer("warehouses")
+	if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, spec(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Layers().Delete(ctx, layer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := engine.InvalidRules(); len(invalid) != 1 || invalid[0] != rule.ID() {
+		t.Fatalf("have %v, want [%s]", invalid, rule.ID())
+	}
+	dangling, err := engine.DanglingRefs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 1 || dangling[0].RefID != layer.ID || dangling[0].Kind != LAYER {
+		t.Fatalf("have %v, want layer %s", dangling, layer.ID)
+	}
+	if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := engine.InvalidRules(); len(invalid) != 0 {
+		t.Fatalf("have %v, want no invalid rules", invalid)
+	}
+
+	engine = New(WithDeletePolicy(DeleteCascade))
+	if err := engine.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	rule, err = engine.AddRule(ctx, spec(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DeleteLayer(ctx, layer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Rules().Lookup(ctx, rule.ID()); !errors.Is(err, ErrRuleNotFound) {
+		t.Fatalf("have %v, want ErrRuleNotFound", err)
+	}
+}
@@ -0,0 +1,316 @@
+package spinix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmadfox/geojson/geometry"
+	"github.com/rs/xid"
+)
+
+type Explanation struct {
+	RuleID   RuleID      `json:"ruleId"`
+	Device   Device      `json:"device"`
+	DateTime int64       `json:"dateTime"`
+	Late     bool        `json:"late"`
+	Stateful bool        `json:"stateful"`
+	Reset    bool        `json:"reset"`
+	Trigger  bool        `json:"trigger"`
+	Match    bool        `json:"match"`
+	Reason   string      `json:"reason,omitempty"`
+	Nodes    []NodeTrace `json:"nodes"`
+}
+
+type NodeTrace struct {
+	Index     int      `json:"index"`
+	Expr      string   `json:"expr"`
+	Value     string   `json:"value,omitempty"`
+	Op        Token    `json:"op,omitempty"`
+	Evaluated bool     `json:"evaluated"`
+	Visited   []xid.ID `json:"visited,omitempty"`
+	Match     Match    `json:"match"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+func (e *Engine) Explain(ctx context.Context, device *Device, ruleID RuleID) (*Explanation, error) {
+	if device == nil {
+		return nil, errDeviceNotSpecified
+	}
+	rule, err := e.refs.rules.Lookup(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	target := *device
+	target.ResetRegion()
+	late, err := e.isLate(ctx, &target)
+	if err != nil {
+		return nil, err
+	}
+	explanation := &Explanation{
+		RuleID:   ruleID,
+		Device:   target,
+		DateTime: e.now(&target),
+		Late:     late,
+		Stateful: rule.spec.isStateful,
+	}
+	trace := newRuleTrace(rule.spec, &target)
+	switch {
+	case e.refIndex.isInvalid(ruleID):
+		explanation.Reason = "rule is marked as invalid"
+	case late && e.latePolicy == LateDrop:
+		explanation.Reason = "late report is dropped"
+	case !rule.covers(target.Latitude, target.Longitude):
+		explanation.Reason = "device is outside of the rule area"
+	default:
+		refs := e.refs
+		refs.objects = traceObjects{Objects: refs.objects, trace: trace}
+		refs.devices = traceDevices{Devices: refs.devices, trace: trace}
+		env := evalEnv{
+			now:      explanation.DateTime,
+			readOnly: true,
+			trace:    trace,
+		}
+		_, explanation.Match, err = rule.spec.evaluate(ctx, rule.id, &target, env, refs)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Reason = trace.reason
+	}
+	explanation.Reset = trace.reset
+	explanation.Trigger = trace.trigger
+	explanation.Nodes = trace.nodes
+	return explanation, nil
+}
+
+func (r *Rule) covers(lat, lon float64) bool {
+	if r.spec.isRegionless() {
+		return true
+	}
+	if !r.bbox.ContainsPoint(geometry.Point{X: lat, Y: lon}) {
+		return false
+	}
+	regionID := RegionFromLatLon(lat, lon, r.regionSize)
+	for _, rid := range r.regions {
+		if rid == regionID {
+			return true
+		}
+	}
+	return false
+}
+
+type ruleTrace struct {
+	current int
+	reset   bool
+	trigger bool
+	reason  string
+	nodes   []NodeTrace
+}
+
+func newRuleTrace(s *spec, d *Device) *ruleTrace {
+	trace := &ruleTrace{
+		current: -1,
+		trigger: !s.isStateful,
+		nodes:   make([]NodeTrace, len(s.nodes)),
+	}
+	for i, node := range s.nodes {
+		trace.nodes[i].Index = i
+		trace.nodes[i].Expr, trace.nodes[i].Value = describeNode(node, d)
+		if i > 0 && i-1 < len(s.ops) {
+			trace.nodes[i].Op = s.ops[i-1]
+		}
+	}
+	return trace
+}
+
+func (t *ruleTrace) stop(reason string) {
+	if t == nil {
+		return
+	}
+	t.reason = reason
+}
+
+func (t *ruleTrace) state(reset, trigger bool) {
+	if t == nil {
+		return
+	}
+	t.reset = reset
+	t.trigger = trigger
+}
+
+func (t *ruleTrace) begin(index int) {
+	if t == nil || index >= len(t.nodes) {
+		return
+	}
+	t.current = index
+	t.nodes[index].Visited = nil
+}
+
+func (t *ruleTrace) end(index int, m Match) {
+	if t == nil || index >= len(t.nodes) {
+		return
+	}
+	t.nodes[index].Evaluated = true
+	t.nodes[index].Match = m
+	t.nodes[index].Reason = ""
+	t.current = -1
+}
+
+func (t *ruleTrace) skip(index int, reason string) {
+	if t == nil || index >= len(t.nodes) {
+		return
+	}
+	t.nodes[index].Reason = reason
+}
+
+func (t *ruleTrace) visit(id xid.ID) {
+	if t == nil || t.current < 0 {
+		return
+	}
+	t.nodes[t.current].Visited = append(t.nodes[t.current].Visited, id)
+}
+
+type traceObjects struct {
+	Objects
+	trace *ruleTrace
+}
+
+func (o traceObjects) Lookup(ctx context.Context, oid ObjectID) (*GeoObject, error) {
+	object, err := o.Objects.Lookup(ctx, oid)
+	if err == nil {
+		o.trace.visit(oid)
+	}
+	return object, err
+}
+
+func (o traceObjects) Each(ctx context.Context, lid LayerID, rid RegionID, fn ObjectIterFunc) error {
+	return o.Objects.Each(ctx, lid, rid, func(ctx context.Context, object *GeoObject) error {
+		o.trace.visit(object.ID())
+		return fn(ctx, object)
+	})
+}
+
+func (o traceObjects) Near(ctx context.Context, lid LayerID, lat, lon, meters float64, fn ObjectIterFunc) error {
+	return o.Objects.Near(ctx, lid, lat, lon, meters, func(ctx context.Context, object *GeoObject) error {
+		o.trace.visit(object.ID())
+		return fn(ctx, object)
+	})
+}
+
+type traceDevices struct {
+	Devices
+	trace *ruleTrace
+}
+
+func (d traceDevices) Lookup(ctx context.Context, id DeviceID) (*Device, error) {
+	device, err := d.Devices.Lookup(ctx, id)
+	if err == nil {
+		d.trace.visit(id)
+	}
+	return device, err
+}
+
+func (d traceDevices) Each(ctx context.Context, rid RegionID, size RegionSize, fn DeviceIterFunc) error {
+	return d.Devices.Each(ctx, rid, size, func(ctx context.Context, device *Device) error {
+		d.trace.visit(device.ID)
+		return fn(ctx, device)
+	})
+}
+
+func (d traceDevices) Near(ctx context.Context, lat, lon, meters float64, fn DeviceIterFunc) error {
+	return d.Devices.Near(ctx, lat, lon, meters, func(ctx context.Context, device *Device) error {
+		d.trace.visit(device.ID)
+		return fn(ctx, device)
+	})
+}
+
+func describeNode(node evaluater, d *Device) (expr string, value string) {
+	values := mapper{device: d}
+	position := fmt.Sprintf("%f %f", d.Latitude, d.Longitude)
+	switch n := node.(type) {
+	case spObjectOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case spDevicesObjectOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case spDevicesOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case spDDevicesOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case equalObjectOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case equalDevicesOp:
+		return fmt.Sprintf("%s %s %s", n.left, n.op, n.right), position
+	case equalIntOp:
+		return fmt.Sprintf("%s %s %d", n.keyword, n.op, n.value), fmt.Sprint(values.intVal(n.keyword))
+	case equalFloatOp:
+		return fmt.Sprintf("%s %s %.2f", n.keyword, n.op, n.value), fmt.Sprint(values.floatVal(n.keyword))
+	case equalStrOp:
+		return fmt.Sprintf("%s %s %q", n.keyword, n.op, n.value), values.stringVal(n.keyword)
+	case equalTimeOp:
+		return fmt.Sprintf("%s %s %02d:%02d", n.keyword, n.op, n.value.h, n.value.m),
+			values.dateTime().Format("15:04")
+	case rangeIntOp:
+		return fmt.Sprintf("%s %s [%d .. %d]", n.keyword, rangeToken(n.not), n.begin, n.end),
+			fmt.Sprint(values.intVal(n.keyword))
+	case rangeFloatOp:
+		return fmt.Sprintf("%s %s [%.2f .. %.2f]", n.keyword, rangeToken(n.not), n.begin, n.end),
+			fmt.Sprint(values.floatVal(n.keyword))
+	case rangeTimeOp:
+		return fmt.Sprintf("%s %s [%02d:%02d .. %02d:%02d]", n.keyword, rangeToken(n.not),
+			n.begin.h, n.begin.m, n.end.h, n.end.m), values.dateTime().Format("15:04")
+	case rangeDateTimeOp:
+		return fmt.Sprintf("%s %s [%s .. %s]", n.keyword, rangeToken(n.not),
+			n.begin.Format(time.RFC3339), n.end.Format(time.RFC3339)), values.dateTime().Format(time.RFC3339)
+	case inIntOp:
+		list := make([]string, 0, len(n.values))
+		for v := range n.values {
+			list = append(list, fmt.Sprint(v))
+		}
+		return fmt.Sprintf("%s %s [%s]", n.keyword, inToken(n.not), joinSorted(list)),
+			fmt.Sprint(values.intVal(n.keyword))
+	case inFloatOp:
+		list := make([]string, 0, len(n.values))
+		for v := range n.values {
+			list = append(list, fmt.Sprintf("%.2f", v))
+		}
+		return fmt.Sprintf("%s %s [%s]", n.keyword, inToken(n.not), joinSorted(list)),
+			fmt.Sprint(values.floatVal(n.keyword))
+	case inStringOp:
+		list := make([]string, 0, len(n.values))
+		for v := range n.values {
+			list = append(list, fmt.Sprintf("%q", v))
+		}
+		return fmt.Sprintf("%s %s [%s]", n.keyword, inToken(n.not), joinSorted(list)),
+			values.stringVal(n.keyword)
+	case trackOp:
+		return fmt.Sprintf("%s %s %.2f", n.keyword, n.op, n.value), position
+	case convoyOp:
+		return fmt.Sprintf("%s(%d devices) %s %.2f", CONVOY, len(n.ids), n.op, n.meters), position
+	case occupancyOp:
+		return fmt.Sprintf("%s(%s) %s %d", OCCUPANCY, n.object, n.op, n.value), position
+	case silenceOp:
+		return fmt.Sprintf("%s %s %s", SILENCE, n.op, n.value), values.dateTime().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%T", node), ""
+}
+
+func rangeToken(not bool) Token {
+	if not {
+		return NRANGE
+	}
+	return RANGE
+}
+
+func inToken(not bool) Token {
+	if not {
+		return NIN
+	}
+	return IN
+}
+
+func joinSorted(list []string) string {
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,76 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEngineExplain(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx,
+		`speed gt 50 AND device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	device.Speed = 20
+	explanation, err := engine.Explain(ctx, device, rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Match {
+		t.Fatalf("have match, want no match")
+	}
+	if !explanation.Trigger || !explanation.Reset || !explanation.Stateful {
+		t.Fatalf("have %+v, want stateful trigger and reset", explanation)
+	}
+	if have, want := len(explanation.Nodes), 2; have != want {
+		t.Fatalf("have %d, want %d nodes", have, want)
+	}
+	speed := explanation.Nodes[0]
+	if !speed.Evaluated || speed.Match.Ok || speed.Value != "20" {
+		t.Fatalf("have %+v, want evaluated speed node with value 20", speed)
+	}
+	intersects := explanation.Nodes[1]
+	if intersects.Evaluated || len(intersects.Reason) == 0 || intersects.Op != AND {
+		t.Fatalf("have %+v, want short-circuited node", intersects)
+	}
+
+	device.Speed = 70
+	explanation, err = engine.Explain(ctx, device, rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !explanation.Match {
+		t.Fatalf("have no match, want match")
+	}
+	intersects = explanation.Nodes[1]
+	if have, want := len(intersects.Visited), 1; have != want {
+		t.Fatalf("have %d, want %d visited objects", have, want)
+	}
+	if have, want := intersects.Visited[0], object.ID(); have != want {
+		t.Fatalf("have %s, want %s visited object", have, want)
+	}
+
+	if _, err := engine.Devices().Lookup(ctx, device.ID); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("have %v, want %v", err, ErrDeviceNotFound)
+	}
+	if _, err := engine.States().Lookup(ctx, StateID{did: device.ID, rid: rule.ID()}); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("have %v, want %v", err, ErrStateNotFound)
+	}
+
+	far := makeDevice("c5vj26evvhfjvfseauk0", 44.9236075, -72.2792333)
+	explanation, err = engine.Explain(ctx, far, rule.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanation.Reason) == 0 {
+		t.Fatalf("have empty reason, want device outside of the rule area")
+	}
+}
@@ -0,0 +1,757 @@
+package spinix
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geometry"
+)
+
+var ErrEmptyGeometry = errors.New("spinix/geometry: empty geometry")
+
+const (
+	metersPerDegree = 111319.49
+	arcStep         = math.Pi / 16
+	clipEpsilon     = 1e-9
+)
+
+// Buffer returns a new object grown by meters. Points become circles,
+// lines become corridors with round ends and polygons get round corners.
+// Concave parts narrower than the distance are not cleaned up.
+//
+// Like the other geometry operations the result keeps the ID and the
+// layer of o, Objects().Update replaces the stored geometry with it.
+// To store it next to o give it a new ID with NewGeoObjectWithID.
+func (o *GeoObject) Buffer(meters float64) (*GeoObject, error) {
+	if meters <= 0 {
+		return nil, fmt.Errorf("spinix/geometry: invalid buffer distance %f", meters)
+	}
+	p := newPlane(o.data.Center())
+	var exterior []vec
+	var holes [][]vec
+	switch data := o.data.(type) {
+	case *geojson.Point:
+		exterior = circleRing(p.toVec(data.Base()), meters)
+	case *geojson.SimplePoint:
+		exterior = circleRing(p.toVec(data.Base()), meters)
+	case *geojson.LineString:
+		line := cleanRing(p.ring(seriesPoints(data.Base())))
+		if len(line) == 1 {
+			exterior = circleRing(line[0], meters)
+			break
+		}
+		// walk the line there and back, the ends become round caps
+		path := make([]vec, 0, 2*len(line))
+		path = append(path, line...)
+		for i := len(line) - 2; i > 0; i-- {
+			path = append(path, line[i])
+		}
+		exterior = offsetRing(path, meters)
+	default:
+		poly, err := polygonOf(o.data)
+		if err != nil {
+			return nil, err
+		}
+		exterior = offsetRing(counterClockwise(p.ring(poly.exterior)), meters)
+		for _, hole := range poly.holes {
+			shrunk := offsetRing(counterClockwise(p.ring(hole)), -meters)
+			if signedArea(shrunk) > 0 {
+				holes = append(holes, shrunk)
+			}
+		}
+	}
+	return o.derive(p.polygon([]vecPolygon{{exterior: exterior, holes: holes}}))
+}
+
+// Simplify returns a new line or polygon simplified with the
+// Douglas-Peucker algorithm. The tolerance is in meters.
+func (o *GeoObject) Simplify(meters float64) (*GeoObject, error) {
+	if meters <= 0 {
+		return nil, fmt.Errorf("spinix/geometry: invalid tolerance %f", meters)
+	}
+	p := newPlane(o.data.Center())
+	if line, ok := o.data.(*geojson.LineString); ok {
+		points := douglasPeucker(p.ring(seriesPoints(line.Base())), meters)
+		return o.derive(geojson.NewLineString(geometry.NewLine(p.points(points, false), nil)), nil)
+	}
+	poly, err := polygonOf(o.data)
+	if err != nil {
+		return nil, err
+	}
+	exterior := simplifyRing(p.ring(poly.exterior), meters)
+	if len(exterior) < 3 {
+		return nil, ErrEmptyGeometry
+	}
+	var holes [][]vec
+	for _, hole := range poly.holes {
+		if hole := simplifyRing(p.ring(hole), meters); len(hole) >= 3 {
+			holes = append(holes, hole)
+		}
+	}
+	return o.derive(p.polygon([]vecPolygon{{exterior: exterior, holes: holes}}))
+}
+
+// ConvexHull returns a new polygon enclosing all points of the object.
+func (o *GeoObject) ConvexHull() (*GeoObject, error) {
+	var points []vec
+	if err := eachPoint(o.data, func(pt geometry.Point) {
+		points = append(points, vec{x: pt.Y, y: pt.X})
+	}); err != nil {
+		return nil, err
+	}
+	hull := convexHull(points)
+	if len(hull) < 3 {
+		return nil, fmt.Errorf("%w - hull of %d points", ErrEmptyGeometry, len(points))
+	}
+	exterior := make([]geometry.Point, 0, len(hull)+1)
+	for _, v := range hull {
+		exterior = append(exterior, geometry.Point{X: v.y, Y: v.x})
+	}
+	exterior = append(exterior, exterior[0])
+	return o.derive(geojson.NewPolygon(geometry.NewPoly(exterior, nil, nil)), nil)
+}
+
+// Union returns a new object covering both polygons with the ID of o.
+func (o *GeoObject) Union(other *GeoObject) (*GeoObject, error) {
+	return o.clip(other, clipUnion)
+}
+
+// Difference returns a new object with the other polygon cut out
+// with the ID of o.
+func (o *GeoObject) Difference(other *GeoObject) (*GeoObject, error) {
+	return o.clip(other, clipDifference)
+}
+
+func (o *GeoObject) clip(other *GeoObject, op clipOp) (*GeoObject, error) {
+	a, err := polygonOf(o.data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := polygonOf(other.data)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.holes) > 0 || len(b.holes) > 0 {
+		return nil, fmt.Errorf("spinix/geometry: polygons with holes are not supported")
+	}
+	rect := o.data.Rect()
+	otherRect := other.data.Rect()
+	rect.Min.X = math.Min(rect.Min.X, otherRect.Min.X)
+	rect.Min.Y = math.Min(rect.Min.Y, otherRect.Min.Y)
+	rect.Max.X = math.Max(rect.Max.X, otherRect.Max.X)
+	rect.Max.Y = math.Max(rect.Max.Y, otherRect.Max.Y)
+	p := newPlane(rect.Center())
+	polygons, err := clipPolygons(p.ring(a.exterior), p.ring(b.exterior), op)
+	if err != nil {
+		return nil, err
+	}
+	return o.derive(p.polygon(polygons))
+}
+
+// derive wraps the geometry into a new object with the ID and the layer
+// of o. The regions of the new object are calculated from its geometry.
+func (o *GeoObject) derive(data geojson.Object, err error) (*GeoObject, error) {
+	if err != nil {
+		return nil, err
+	}
+	return NewGeoObject(o.id, o.lid, data), nil
+}
+
+type vec struct {
+	x, y float64
+}
+
+func (v vec) sub(o vec) vec {
+	return vec{x: v.x - o.x, y: v.y - o.y}
+}
+
+func cross(a, b vec) float64 {
+	return a.x*b.y - a.y*b.x
+}
+
+func dot(a, b vec) float64 {
+	return a.x*b.x + a.y*b.y
+}
+
+// plane is a local equirectangular projection in meters,
+// x points east and y points north.
+type plane struct {
+	lat, lon float64
+	k        float64
+}
+
+func newPlane(center geometry.Point) plane {
+	return plane{
+		lat: center.X,
+		lon: center.Y,
+		k:   math.Cos(center.X * math.Pi / 180),
+	}
+}
+
+func (p plane) toVec(pt geometry.Point) vec {
+	return vec{
+		x: (pt.Y - p.lon) * p.k * metersPerDegree,
+		y: (pt.X - p.lat) * metersPerDegree,
+	}
+}
+
+func (p plane) toPoint(v vec) geometry.Point {
+	return geometry.Point{
+		X: p.lat + v.y/metersPerDegree,
+		Y: p.lon + v.x/(p.k*metersPerDegree),
+	}
+}
+
+func (p plane) ring(points []geometry.Point) []vec {
+	ring := make([]vec, len(points))
+	for i, pt := range points {
+		ring[i] = p.toVec(pt)
+	}
+	return ring
+}
+
+func (p plane) points(ring []vec, closed bool) []geometry.Point {
+	points := make([]geometry.Point, 0, len(ring)+1)
+	for _, v := range ring {
+		points = append(points, p.toPoint(v))
+	}
+	if closed && len(points) > 0 {
+		points = append(points, points[0])
+	}
+	return points
+}
+
+type vecPolygon struct {
+	exterior []vec
+	holes    [][]vec
+}
+
+// polygon converts the polygons back to coordinates. Exteriors are
+// counterclockwise and holes clockwise.
+func (p plane) polygon(polygons []vecPolygon) (geojson.Object, error) {
+	polys := make([]*geometry.Poly, 0, len(polygons))
+	for _, poly := range polygons {
+		exterior := cleanRing(poly.exterior)
+		if len(exterior) < 3 {
+			continue
+		}
+		var holes [][]geometry.Point
+		for _, hole := range poly.holes {
+			if hole = cleanRing(hole); len(hole) >= 3 {
+				holes = append(holes, p.points(reversed(counterClockwise(hole)), true))
+			}
+		}
+		polys = append(polys, geometry.NewPoly(p.points(counterClockwise(exterior), true), holes, nil))
+	}
+	switch len(polys) {
+	case 0:
+		return nil, ErrEmptyGeometry
+	case 1:
+		return geojson.NewPolygon(polys[0]), nil
+	default:
+		return geojson.NewMultiPolygon(polys), nil
+	}
+}
+
+type polygonPoints struct {
+	exterior []geometry.Point
+	holes    [][]geometry.Point
+}
+
+func polygonOf(data geojson.Object) (poly polygonPoints, err error) {
+	switch data := data.(type) {
+	case *geojson.Polygon:
+		base := data.Base()
+		poly.exterior = seriesPoints(base.Exterior)
+		for _, hole := range base.Holes {
+			poly.holes = append(poly.holes, seriesPoints(hole))
+		}
+	case *geojson.Rect:
+		rect := data.Base()
+		poly.exterior = []geometry.Point{
+			rect.Min, {X: rect.Max.X, Y: rect.Min.Y}, rect.Max, {X: rect.Min.X, Y: rect.Max.Y},
+		}
+	case *geojson.Circle:
+		p := newPlane(data.Center())
+		poly.exterior = p.points(circleRing(vec{}, data.Meters()), false)
+	default:
+		return poly, fmt.Errorf("spinix/geometry: %T is not a polygon", data)
+	}
+	if len(poly.exterior) < 3 {
+		return poly, ErrEmptyGeometry
+	}
+	return poly, nil
+}
+
+// seriesPoints returns the points of the series without the closing point.
+func seriesPoints(s geometry.Series) []geometry.Point {
+	n := s.NumPoints()
+	points := make([]geometry.Point, 0, n)
+	for i := 0; i < n; i++ {
+		points = append(points, s.PointAt(i))
+	}
+	if n > 1 && points[0] == points[n-1] {
+		points = points[:n-1]
+	}
+	return points
+}
+
+func eachPoint(data geojson.Object, fn func(pt geometry.Point)) error {
+	switch data := data.(type) {
+	case *geojson.Point:
+		fn(data.Base())
+	case *geojson.SimplePoint:
+		fn(data.Base())
+	case *geojson.LineString:
+		for _, pt := range seriesPoints(data.Base()) {
+			fn(pt)
+		}
+	case *geojson.Polygon, *geojson.Rect, *geojson.Circle:
+		poly, err := polygonOf(data)
+		if err != nil {
+			return err
+		}
+		for _, pt := range poly.exterior {
+			fn(pt)
+		}
+	case *geojson.Feature:
+		return eachPoint(data.Base(), fn)
+	case interface{ Children() []geojson.Object }:
+		for _, child := range data.Children() {
+			if err := eachPoint(child, fn); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("spinix/geometry: %T is not supported", data)
+	}
+	return nil
+}
+
+func signedArea(ring []vec) (area float64) {
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		area += cross(ring[i], ring[j])
+	}
+	return area / 2
+}
+
+func counterClockwise(ring []vec) []vec {
+	if signedArea(ring) < 0 {
+		return reversed(ring)
+	}
+	return ring
+}
+
+func reversed(ring []vec) []vec {
+	res := make([]vec, len(ring))
+	for i, v := range ring {
+		res[len(ring)-1-i] = v
+	}
+	return res
+}
+
+// cleanRing drops repeated points, including the closing one.
+func cleanRing(ring []vec) []vec {
+	res := make([]vec, 0, len(ring))
+	for _, v := range ring {
+		if len(res) == 0 || res[len(res)-1] != v {
+			res = append(res, v)
+		}
+	}
+	for len(res) > 1 && res[0] == res[len(res)-1] {
+		res = res[:len(res)-1]
+	}
+	return res
+}
+
+func insideRing(v vec, ring []vec) (inside bool) {
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.y > v.y) != (b.y > v.y) && v.x < (b.x-a.x)*(v.y-a.y)/(b.y-a.y)+a.x {
+			inside = !inside
+		}
+	}
+	return
+}
+
+func circleRing(center vec, radius float64) []vec {
+	steps := int(2 * math.Pi / arcStep)
+	ring := make([]vec, steps)
+	for i := range ring {
+		a := 2 * math.Pi * float64(i) / float64(steps)
+		ring[i] = vec{x: center.x + radius*math.Cos(a), y: center.y + radius*math.Sin(a)}
+	}
+	return ring
+}
+
+// offsetRing moves every edge of a counterclockwise ring by d to its
+// outer side and joins the edges with arcs where they move apart.
+// A negative d moves the edges inwards.
+func offsetRing(ring []vec, d float64) []vec {
+	ring = cleanRing(ring)
+	n := len(ring)
+	res := make([]vec, 0, 2*n)
+	for i := 0; i < n; i++ {
+		prev, cur, next := ring[(i+n-1)%n], ring[i], ring[(i+1)%n]
+		n1, n2 := rightNormal(prev, cur), rightNormal(cur, next)
+		cos := dot(n1, n2)
+		delta := math.Atan2(cross(n1, n2), cos)
+		if cos < -1+clipEpsilon {
+			// the path turns back, go around the end
+			delta = math.Pi
+		}
+		switch {
+		case delta*d > 0:
+			a := math.Atan2(d*n1.y, d*n1.x)
+			steps := int(math.Ceil(math.Abs(delta) / arcStep))
+			r := math.Abs(d)
+			for k := 0; k <= steps; k++ {
+				t := a + delta*float64(k)/float64(steps)
+				res = append(res, vec{x: cur.x + r*math.Cos(t), y: cur.y + r*math.Sin(t)})
+			}
+		case 1+cos > 0.1:
+			k := d / (1 + cos)
+			res = append(res, vec{x: cur.x + k*(n1.x+n2.x), y: cur.y + k*(n1.y+n2.y)})
+		default:
+			res = append(res,
+				vec{x: cur.x + d*n1.x, y: cur.y + d*n1.y},
+				vec{x: cur.x + d*n2.x, y: cur.y + d*n2.y})
+		}
+	}
+	return res
+}
+
+func rightNormal(a, b vec) vec {
+	e := b.sub(a)
+	l := math.Hypot(e.x, e.y)
+	return vec{x: e.y / l, y: -e.x / l}
+}
+
+func segmentDistance(p, a, b vec) float64 {
+	ab := b.sub(a)
+	l := dot(ab, ab)
+	if l == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	t := math.Max(0, math.Min(1, dot(p.sub(a), ab)/l))
+	return math.Hypot(p.x-(a.x+t*ab.x), p.y-(a.y+t*ab.y))
+}
+
+func douglasPeucker(points []vec, tolerance float64) []vec {
+	if len(points) < 3 {
+		return points
+	}
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	var simplify func(first, last int)
+	simplify = func(first, last int) {
+		index, max := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(points[i], points[first], points[last]); d > max {
+				index, max = i, d
+			}
+		}
+		if index < 0 {
+			return
+		}
+		keep[index] = true
+		simplify(first, index)
+		simplify(index, last)
+	}
+	simplify(0, len(points)-1)
+	res := make([]vec, 0, len(points))
+	for i, v := range points {
+		if keep[i] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// simplifyRing splits the ring at the point farthest from its
+// first point and simplifies both halves.
+func simplifyRing(ring []vec, tolerance float64) []vec {
+	ring = cleanRing(ring)
+	if len(ring) < 4 {
+		return ring
+	}
+	far, max := 0, 0.0
+	for i, v := range ring {
+		if d := math.Hypot(v.x-ring[0].x, v.y-ring[0].y); d > max {
+			far, max = i, d
+		}
+	}
+	closed := append(append(make([]vec, 0, len(ring)+1), ring...), ring[0])
+	head := douglasPeucker(closed[:far+1], tolerance)
+	tail := douglasPeucker(closed[far:], tolerance)
+	return append(head, tail[1:len(tail)-1]...)
+}
+
+// convexHull returns the hull in counterclockwise order
+// using the monotone chain algorithm.
+func convexHull(points []vec) []vec {
+	points = append([]vec(nil), points...)
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].x == points[j].x {
+			return points[i].y < points[j].y
+		}
+		return points[i].x < points[j].x
+	})
+	if len(points) < 3 {
+		return points
+	}
+	hull := make([]vec, 0, 2*len(points))
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, v := range points {
+			for len(hull) >= start+2 && cross(hull[len(hull)-1].sub(hull[len(hull)-2]), v.sub(hull[len(hull)-2])) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, v)
+		}
+		hull = hull[:len(hull)-1]
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	return hull
+}
+
+type clipOp int
+
+const (
+	clipUnion clipOp = iota
+	clipDifference
+)
+
+var errDegenerate = errors.New("spinix/geometry: degenerate intersection")
+
+// clipPolygons applies the Greiner-Hormann algorithm to two simple
+// polygons. Touching boundaries are resolved by slightly growing the
+// clip polygon, which moves the result by a few millimeters at most.
+func clipPolygons(subject, clip []vec, op clipOp) ([]vecPolygon, error) {
+	subject, clip = cleanRing(subject), cleanRing(clip)
+	if len(subject) < 3 || len(clip) < 3 {
+		return nil, ErrEmptyGeometry
+	}
+	for attempt := 0; attempt < 4; attempt++ {
+		grown := clip
+		if attempt > 0 {
+			grown = scaleRing(clip, math.Pow(10, float64(attempt))*1e-7)
+		}
+		polygons, err := greinerHormann(subject, grown, op)
+		if errors.Is(err, errDegenerate) {
+			continue
+		}
+		return polygons, err
+	}
+	return nil, errDegenerate
+}
+
+func scaleRing(ring []vec, k float64) []vec {
+	var c vec
+	for _, v := range ring {
+		c.x += v.x
+		c.y += v.y
+	}
+	c.x /= float64(len(ring))
+	c.y /= float64(len(ring))
+	res := make([]vec, len(ring))
+	for i, v := range ring {
+		res[i] = vec{x: c.x + (v.x-c.x)*(1+k), y: c.y + (v.y-c.y)*(1+k)}
+	}
+	return res
+}
+
+type clipVertex struct {
+	p         vec
+	next      *clipVertex
+	prev      *clipVertex
+	neighbor  *clipVertex
+	alpha     float64
+	intersect bool
+	entry     bool
+	visited   bool
+}
+
+func newClipList(ring []vec) []*clipVertex {
+	vertices := make([]*clipVertex, len(ring))
+	for i, v := range ring {
+		vertices[i] = &clipVertex{p: v}
+	}
+	for i, v := range vertices {
+		v.next = vertices[(i+1)%len(vertices)]
+		v.prev = vertices[(i+len(vertices)-1)%len(vertices)]
+	}
+	return vertices
+}
+
+// insertAfter puts the intersection between from and the next
+// original vertex, ordered by alpha.
+func (v *clipVertex) insertAfter(iv *clipVertex) {
+	cur := v
+	for cur.next.intersect && cur.next.alpha < iv.alpha {
+		cur = cur.next
+	}
+	iv.next, iv.prev = cur.next, cur
+	cur.next.prev = iv
+	cur.next = iv
+}
+
+func greinerHormann(subjectRing, clipRing []vec, op clipOp) ([]vecPolygon, error) {
+	subject, clip := newClipList(subjectRing), newClipList(clipRing)
+	var intersections int
+	for i, s1 := range subject {
+		s2 := subject[(i+1)%len(subject)]
+		for j, c1 := range clip {
+			c2 := clip[(j+1)%len(clip)]
+			es, ec := s2.p.sub(s1.p), c2.p.sub(c1.p)
+			d := cross(es, ec)
+			w := c1.p.sub(s1.p)
+			if math.Abs(d) <= clipEpsilon*math.Hypot(es.x, es.y)*math.Hypot(ec.x, ec.y) {
+				if math.Abs(cross(w, es)) <= clipEpsilon*dot(es, es) && overlaps(s1.p, s2.p, c1.p, c2.p) {
+					return nil, errDegenerate
+				}
+				continue
+			}
+			ta, tb := cross(w, ec)/d, cross(w, es)/d
+			if ta < -clipEpsilon || ta > 1+clipEpsilon || tb < -clipEpsilon || tb > 1+clipEpsilon {
+				continue
+			}
+			if ta < clipEpsilon || ta > 1-clipEpsilon || tb < clipEpsilon || tb > 1-clipEpsilon {
+				return nil, errDegenerate
+			}
+			p := vec{x: s1.p.x + ta*es.x, y: s1.p.y + ta*es.y}
+			is := &clipVertex{p: p, alpha: ta, intersect: true}
+			ic := &clipVertex{p: p, alpha: tb, intersect: true}
+			is.neighbor, ic.neighbor = ic, is
+			s1.insertAfter(is)
+			c1.insertAfter(ic)
+			intersections++
+		}
+	}
+
+	subjectInClip := insideRing(subjectRing[0], clipRing)
+	clipInSubject := insideRing(clipRing[0], subjectRing)
+	if intersections == 0 {
+		switch {
+		case op == clipUnion && subjectInClip:
+			return []vecPolygon{{exterior: clipRing}}, nil
+		case op == clipUnion && clipInSubject:
+			return []vecPolygon{{exterior: subjectRing}}, nil
+		case op == clipUnion:
+			return []vecPolygon{{exterior: subjectRing}, {exterior: clipRing}}, nil
+		case subjectInClip:
+			return nil, ErrEmptyGeometry
+		case clipInSubject:
+			return []vecPolygon{{exterior: subjectRing, holes: [][]vec{clipRing}}}, nil
+		default:
+			return []vecPolygon{{exterior: subjectRing}}, nil
+		}
+	}
+
+	// union walks both boundaries outside of the other polygon,
+	// difference walks the subject outside and the clip inside
+	subjectForward, clipForward := false, op == clipDifference
+	markEntries(subject[0], subjectForward != subjectInClip)
+	markEntries(clip[0], clipForward != clipInSubject)
+
+	var rings [][]vec
+	for {
+		current := firstUnvisited(subject[0])
+		if current == nil {
+			break
+		}
+		ring := []vec{current.p}
+		for !current.visited {
+			current.visited, current.neighbor.visited = true, true
+			forward := current.entry
+			for {
+				if forward {
+					current = current.next
+				} else {
+					current = current.prev
+				}
+				ring = append(ring, current.p)
+				if current.intersect {
+					break
+				}
+			}
+			current = current.neighbor
+		}
+		if ring = cleanRing(ring); len(ring) >= 3 {
+			rings = append(rings, ring)
+		}
+	}
+	return nestRings(rings), nil
+}
+
+func overlaps(a1, a2, b1, b2 vec) bool {
+	e := a2.sub(a1)
+	l := dot(e, e)
+	t1, t2 := dot(b1.sub(a1), e)/l, dot(b2.sub(a1), e)/l
+	if t1 > t2 {
+		t1, t2 = t2, t1
+	}
+	return t2 > clipEpsilon && t1 < 1-clipEpsilon
+}
+
+func markEntries(first *clipVertex, entry bool) {
+	v := first
+	for {
+		if v.intersect {
+			v.entry = entry
+			entry = !entry
+		}
+		if v = v.next; v == first {
+			return
+		}
+	}
+}
+
+func firstUnvisited(first *clipVertex) *clipVertex {
+	v := first
+	for {
+		if v.intersect && !v.visited {
+			return v
+		}
+		if v = v.next; v == first {
+			return nil
+		}
+	}
+}
+
+// nestRings turns the rings that lie inside other rings into holes.
+func nestRings(rings [][]vec) []vecPolygon {
+	sort.Slice(rings, func(i, j int) bool {
+		return math.Abs(signedArea(rings[i])) > math.Abs(signedArea(rings[j]))
+	})
+	var polygons []vecPolygon
+next:
+	for _, ring := range rings {
+		for i := range polygons {
+			if ringInside(ring, polygons[i].exterior) {
+				polygons[i].holes = append(polygons[i].holes, ring)
+				continue next
+			}
+		}
+		polygons = append(polygons, vecPolygon{exterior: ring})
+	}
+	return polygons
+}
+
+// ringInside tells whether most vertices of the ring are inside the other
+// ring. Clipped rings share vertices, so a single vertex is not enough.
+func ringInside(ring, other []vec) bool {
+	var inside int
+	for _, v := range ring {
+		if insideRing(v, other) {
+			inside++
+		}
+	}
+	return 2*inside > len(ring)
+}
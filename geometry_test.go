@@ -0,0 +1,158 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geometry"
+)
+
+func squareObject(lat, lon, size float64) *GeoObject {
+	return NewGeoObjectWithID(DefaultLayer, geojson.NewPolygon(geometry.NewPoly([]geometry.Point{
+		{X: lat, Y: lon},
+		{X: lat + size, Y: lon},
+		{X: lat + size, Y: lon + size},
+		{X: lat, Y: lon + size},
+		{X: lat, Y: lon},
+	}, nil, nil)))
+}
+
+func polyArea(t *testing.T, o *GeoObject) (area float64) {
+	poly, ok := o.data.(*geojson.Polygon)
+	if !ok {
+		t.Fatalf("have %T, want *geojson.Polygon", o.data)
+	}
+	p := newPlane(o.data.Center())
+	area = math.Abs(signedArea(p.ring(seriesPoints(poly.Base().Exterior))))
+	for _, hole := range poly.Base().Holes {
+		area -= math.Abs(signedArea(p.ring(seriesPoints(hole))))
+	}
+	return area
+}
+
+func TestGeoObjectBuffer(t *testing.T) {
+	square := squareObject(42.92, -72.27, 0.01)
+	buffered, err := square.Buffer(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !square.Within(buffered) {
+		t.Fatal("buffer does not contain the original polygon")
+	}
+	if len(buffered.RegionID()) == 0 || buffered.id != square.id {
+		t.Fatal("buffer is not an indexed object with the source ID")
+	}
+	outside := NewGeoObjectWithID(DefaultLayer, geojson.NewPoint(geometry.Point{X: 42.9315, Y: -72.27}))
+	if !outside.Within(buffered) {
+		t.Fatal("point 160 m away is outside of the buffer")
+	}
+	if _, err := square.Buffer(0); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}
+
+func TestEngineReplaceDerivedObject(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	square := squareObject(42.92, -72.27, 0.01)
+	if err := engine.Objects().Add(ctx, square); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(`+square.ID().String()+`) { :center 42.925 -72.265 :radius 5km }`); err != nil {
+		t.Fatal(err)
+	}
+	// 160 m north of the square
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9315, -72.265)
+	if events, _, err := engine.Detect(ctx, device); err != nil || len(events) != 0 {
+		t.Fatalf("have %d events, %v, want 0 events", len(events), err)
+	}
+	buffered, err := square.Buffer(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Objects().Update(ctx, buffered); err != nil {
+		t.Fatal(err)
+	}
+	if events, _, err := engine.Detect(ctx, device); err != nil || len(events) != 1 {
+		t.Fatalf("have %d events, %v, want 1 event", len(events), err)
+	}
+}
+
+func TestGeoObjectUnionDifference(t *testing.T) {
+	a := squareObject(42.92, -72.27, 0.01)
+	b := squareObject(42.925, -72.265, 0.01)
+	union, err := a.Union(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := polyArea(t, union)/polyArea(t, a), 1.75; have < want-0.01 || have > want+0.01 {
+		t.Fatalf("have union area ratio %f, want %f", have, want)
+	}
+	if !squareObject(42.9201, -72.2699, 0.0098).Within(union) || !squareObject(42.9251, -72.2649, 0.0098).Within(union) {
+		t.Fatal("union does not contain both polygons")
+	}
+
+	diff, err := a.Difference(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := polyArea(t, diff)/polyArea(t, a), 0.75; have < want-0.01 || have > want+0.01 {
+		t.Fatalf("have difference area ratio %f, want %f", have, want)
+	}
+
+	dock := squareObject(42.922, -72.268, 0.002)
+	diff, err = a.Difference(dock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holes := len(diff.data.(*geojson.Polygon).Base().Holes); holes != 1 {
+		t.Fatalf("have %d holes, want 1", holes)
+	}
+	if _, err := dock.Difference(a); !errors.Is(err, ErrEmptyGeometry) {
+		t.Fatalf("have %v, want ErrEmptyGeometry", err)
+	}
+
+	// shared edge
+	c := squareObject(42.92, -72.26, 0.01)
+	union, err = a.Union(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := polyArea(t, union)/polyArea(t, a), 2.0; have < want-0.01 || have > want+0.01 {
+		t.Fatalf("have union area ratio %f, want %f", have, want)
+	}
+}
+
+func TestGeoObjectSimplifyConvexHull(t *testing.T) {
+	points := []geometry.Point{
+		{X: 42.92, Y: -72.27},
+		{X: 42.92001, Y: -72.265},
+		{X: 42.92, Y: -72.26},
+		{X: 42.925, Y: -72.262},
+		{X: 42.93, Y: -72.26},
+		{X: 42.93, Y: -72.27},
+		{X: 42.92, Y: -72.27},
+	}
+	o := NewGeoObjectWithID(DefaultLayer, geojson.NewPolygon(geometry.NewPoly(points, nil, nil)))
+	simplified, err := o.Simplify(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := simplified.data.(*geojson.Polygon).Base().Exterior.NumPoints(), 6; have != want {
+		t.Fatalf("have %d points, want %d", have, want)
+	}
+
+	hull, err := o.ConvexHull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := hull.data.(*geojson.Polygon).Base().Exterior.NumPoints(), 5; have != want {
+		t.Fatalf("have %d points, want %d", have, want)
+	}
+	if !o.Within(hull) {
+		t.Fatal("hull does not contain the polygon")
+	}
+}
@@ -0,0 +1,391 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geo"
+	"github.com/mmadfox/geojson/geometry"
+	"github.com/rs/xid"
+)
+
+var (
+	ErrHistoryNotFound = errors.New("spinix/history: not found")
+	ErrHistoryDisabled = errors.New("spinix/history: disabled")
+)
+
+const (
+	defaultHistoryCapacity = 1000
+	stopRadiusMeters       = 30
+)
+
+type PositionIterFunc func(ctx context.Context, p Position) error
+
+type History interface {
+	Append(ctx context.Context, d *Device) error
+	Track(ctx context.Context, id DeviceID, from, to int64) (Track, error)
+	At(ctx context.Context, id DeviceID, dateTime int64) (Position, error)
+	Replay(ctx context.Context, id DeviceID, from, to int64, fn PositionIterFunc) error
+	Delete(ctx context.Context, id DeviceID) error
+}
+
+type Position struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Altitude  float64 `json:"alt"`
+	Speed     float64 `json:"speed"`
+	DateTime  int64   `json:"dateTime"`
+}
+
+func PositionFromDevice(d *Device) Position {
+	return Position{
+		Latitude:  d.Latitude,
+		Longitude: d.Longitude,
+		Altitude:  d.Altitude,
+		Speed:     d.Speed,
+		DateTime:  d.DateTime,
+	}
+}
+
+// Track is a time-ordered list of positions.
+type Track []Position
+
+func (t Track) LineString() *geojson.LineString {
+	points := make([]geometry.Point, len(t))
+	for i, p := range t {
+		points[i] = geometry.Point{X: p.Latitude, Y: p.Longitude}
+	}
+	return geojson.NewLineString(geometry.NewLine(points, nil))
+}
+
+// Distance returns the travelled distance in meters.
+func (t Track) Distance() (meters float64) {
+	for i := 1; i < len(t); i++ {
+		meters += geo.DistanceTo(t[i-1].Latitude, t[i-1].Longitude, t[i].Latitude, t[i].Longitude)
+	}
+	return
+}
+
+// StoppedFor returns how long the track stays within the radius
+// of its last position.
+func (t Track) StoppedFor(meters float64) time.Duration {
+	if len(t) < 2 {
+		return 0
+	}
+	last := t[len(t)-1]
+	since := last.DateTime
+	for i := len(t) - 2; i >= 0; i-- {
+		if geo.DistanceTo(t[i].Latitude, t[i].Longitude, last.Latitude, last.Longitude) > meters {
+			break
+		}
+		since = t[i].DateTime
+	}
+	return time.Duration(last.DateTime-since) * time.Second
+}
+
+type HistoryOption func(*history)
+
+func WithHistoryCapacity(n int) HistoryOption {
+	return func(h *history) {
+		h.capacity = n
+	}
+}
+
+func WithHistoryMaxAge(d time.Duration) HistoryOption {
+	return func(h *history) {
+		h.maxAge = int64(d.Seconds())
+	}
+}
+
+type history struct {
+	capacity int
+	maxAge   int64
+	buckets  []*historyBucket
+}
+
+type historyBucket struct {
+	sync.RWMutex
+	index map[DeviceID]Track
+}
+
+// NewMemoryHistory returns a bounded in-memory history that keeps
+// the last positions of every device.
+func NewMemoryHistory(opts ...HistoryOption) History {
+	h := &history{
+		capacity: defaultHistoryCapacity,
+		buckets:  make([]*historyBucket, numBucket),
+	}
+	for _, f := range opts {
+		f(h)
+	}
+	for i := 0; i < numBucket; i++ {
+		h.buckets[i] = &historyBucket{
+			index: make(map[DeviceID]Track),
+		}
+	}
+	return h
+}
+
+func (h *history) bucket(id DeviceID) *historyBucket {
+	return h.buckets[bucketFromID(id, numBucket)]
+}
+
+func (h *history) Append(_ context.Context, d *Device) error {
+	if d == nil {
+		return fmt.Errorf("spinix/history: device not specified")
+	}
+	pos := PositionFromDevice(d)
+	bucket := h.bucket(d.ID)
+	bucket.Lock()
+	defer bucket.Unlock()
+	track := bucket.index[d.ID]
+	// reports usually arrive in order, so this is an append
+	i := sort.Search(len(track), func(i int) bool {
+		return track[i].DateTime > pos.DateTime
+	})
+	track = append(track, Position{})
+	copy(track[i+1:], track[i:])
+	track[i] = pos
+	if h.capacity > 0 && len(track) > h.capacity {
+		track = track[len(track)-h.capacity:]
+	}
+	if h.maxAge > 0 {
+		last := track[len(track)-1].DateTime
+		n := sort.Search(len(track), func(i int) bool {
+			return last-track[i].DateTime <= h.maxAge
+		})
+		track = track[n:]
+	}
+	bucket.index[d.ID] = track
+	return nil
+}
+
+func (h *history) Track(_ context.Context, id DeviceID, from, to int64) (Track, error) {
+	bucket := h.bucket(id)
+	bucket.RLock()
+	defer bucket.RUnlock()
+	track, ok := bucket.index[id]
+	if !ok {
+		return nil, fmt.Errorf("%w - %s", ErrHistoryNotFound, id)
+	}
+	track = track.between(from, to)
+	res := make(Track, len(track))
+	copy(res, track)
+	return res, nil
+}
+
+func (h *history) At(_ context.Context, id DeviceID, dateTime int64) (Position, error) {
+	bucket := h.bucket(id)
+	bucket.RLock()
+	defer bucket.RUnlock()
+	track, ok := bucket.index[id]
+	if !ok || len(track) == 0 || dateTime < track[0].DateTime {
+		return Position{}, fmt.Errorf("%w - %s at %d", ErrHistoryNotFound, id, dateTime)
+	}
+	return track.at(dateTime), nil
+}
+
+func (h *history) Replay(ctx context.Context, id DeviceID, from, to int64, fn PositionIterFunc) error {
+	track, err := h.Track(ctx, id, from, to)
+	if err != nil {
+		return err
+	}
+	for _, p := range track {
+		if err := fn(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *history) Delete(_ context.Context, id DeviceID) error {
+	bucket := h.bucket(id)
+	bucket.Lock()
+	defer bucket.Unlock()
+	if _, ok := bucket.index[id]; !ok {
+		return fmt.Errorf("%w - %s", ErrHistoryNotFound, id)
+	}
+	delete(bucket.index, id)
+	return nil
+}
+
+// between returns the positions in [from, to]. Zero to means no upper bound.
+func (t Track) between(from, to int64) Track {
+	begin := sort.Search(len(t), func(i int) bool {
+		return t[i].DateTime >= from
+	})
+	end := len(t)
+	if to > 0 {
+		end = sort.Search(len(t), func(i int) bool {
+			return t[i].DateTime > to
+		})
+	}
+	if begin >= end {
+		return nil
+	}
+	return t[begin:end]
+}
+
+// at interpolates the position between the two nearest fixes.
+func (t Track) at(dateTime int64) Position {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].DateTime > dateTime
+	})
+	if i == len(t) {
+		return t[i-1]
+	}
+	prev, next := t[i-1], t[i]
+	if prev.DateTime == dateTime || next.DateTime == prev.DateTime {
+		return prev
+	}
+	k := float64(dateTime-prev.DateTime) / float64(next.DateTime-prev.DateTime)
+	return Position{
+		Latitude:  prev.Latitude + (next.Latitude-prev.Latitude)*k,
+		Longitude: prev.Longitude + (next.Longitude-prev.Longitude)*k,
+		Altitude:  prev.Altitude + (next.Altitude-prev.Altitude)*k,
+		Speed:     prev.Speed + (next.Speed-prev.Speed)*k,
+		DateTime:  dateTime,
+	}
+}
+
+// Track returns the positions of the device reported between from and to.
+// A zero to means the current clock time.
+func (e *Engine) Track(ctx context.Context, id DeviceID, from, to time.Time) (Track, error) {
+	if e.refs.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	return e.refs.history.Track(ctx, id, from.Unix(), e.until(to))
+}
+
+// PositionAt returns where the device was at the given time.
+func (e *Engine) PositionAt(ctx context.Context, id DeviceID, t time.Time) (Position, error) {
+	if e.refs.history == nil {
+		return Position{}, ErrHistoryDisabled
+	}
+	return e.refs.history.At(ctx, id, t.Unix())
+}
+
+// Replay calls fn for every position of the device between from and to.
+// A zero to means the current clock time.
+func (e *Engine) Replay(ctx context.Context, id DeviceID, from, to time.Time, fn PositionIterFunc) error {
+	if e.refs.history == nil {
+		return ErrHistoryDisabled
+	}
+	return e.refs.history.Replay(ctx, id, from.Unix(), e.until(to), fn)
+}
+
+func (e *Engine) until(to time.Time) int64 {
+	if to.IsZero() {
+		return e.clock.Now().Unix()
+	}
+	return to.Unix()
+}
+
+func (e *Engine) deleteHistory(ctx context.Context, id DeviceID) error {
+	if e.refs.history == nil {
+		return nil
+	}
+	if err := e.refs.history.Delete(ctx, id); err != nil && !errors.Is(err, ErrHistoryNotFound) {
+		return err
+	}
+	return nil
+}
+
+// trackOp compares the distance travelled or the time stopped. Without
+// a window the whole track kept by History is used, so travelled grows
+// until the history retention drops the old positions.
+type trackOp struct {
+	keyword Token
+	window  time.Duration
+	value   float64
+	op      Token
+	pos     Pos
+}
+
+func e2track(lhs *TrackLit, right Expr, op Token) (evaluater, error) {
+	node := trackOp{keyword: lhs.Kind, window: lhs.Window, op: op, pos: lhs.Pos}
+	switch rhs := right.(type) {
+	case *IntLit:
+		if lhs.Kind == TRAVELLED {
+			node.value = float64(rhs.Value)
+			return node, nil
+		}
+	case *FloatLit:
+		if lhs.Kind == TRAVELLED {
+			node.value = rhs.Value
+			return node, nil
+		}
+	case *DurationLit:
+		if lhs.Kind == STOPPED {
+			node.value = rhs.Value.Seconds()
+			return node, nil
+		}
+	}
+	expected := "[INT, FLOAT]"
+	if lhs.Kind == STOPPED {
+		expected = DURATION.String()
+	}
+	return nil, &InvalidExprError{
+		Left:  lhs,
+		Right: right,
+		Op:    op,
+		Pos:   lhs.Pos,
+		Msg:   fmt.Sprintf("got %s, expected %s", right, expected),
+	}
+}
+
+func (n trackOp) refIDs() (refs map[xid.ID]Token) { return }
+
+func (n trackOp) evaluate(ctx context.Context, d *Device, state *State, r reference, _ *specProps) (match Match, err error) {
+	match.Left.Keyword = n.keyword
+	match.Right.Keyword = FLOAT
+	match.Pos = n.pos
+	match.Operator = n.op
+	if r.history == nil {
+		return
+	}
+	var from, to int64
+	if n.window > 0 {
+		// history stamps fixes without a time with the detect time
+		to = d.DateTime
+		if to <= 0 && state != nil {
+			to = state.now
+		}
+		from = to - int64(n.window.Seconds())
+	}
+	track, err := r.history.Track(ctx, d.ID, from, to)
+	if err != nil {
+		if errors.Is(err, ErrHistoryNotFound) {
+			err = nil
+		}
+		return
+	}
+	value := n.valueOf(track)
+	switch n.op {
+	case EQ:
+		match.Ok = value == n.value
+	case LT:
+		match.Ok = value < n.value
+	case GT:
+		match.Ok = value > n.value
+	case NE:
+		match.Ok = value != n.value
+	case LTE:
+		match.Ok = value <= n.value
+	case GTE:
+		match.Ok = value >= n.value
+	}
+	return
+}
+
+func (n trackOp) valueOf(track Track) float64 {
+	if n.keyword == STOPPED {
+		return track.StoppedFor(stopRadiusMeters).Seconds()
+	}
+	return track.Distance()
+}
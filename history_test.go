@@ -0,0 +1,174 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	h := NewMemoryHistory(WithHistoryCapacity(3))
+	id := did("c5vj26evvhfjvfseauk0")
+	for i, dateTime := range []int64{10, 30, 20, 40} {
+		d := makeDevice(id.String(), 42.92+float64(i)*0.001, -72.27)
+		d.DateTime = dateTime
+		if err := h.Append(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	track, err := h.Track(ctx, id, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track) != 3 {
+		t.Fatalf("have %d positions, want 3", len(track))
+	}
+	for i, want := range []int64{20, 30, 40} {
+		if track[i].DateTime != want {
+			t.Fatalf("have %d, want %d", track[i].DateTime, want)
+		}
+	}
+	track, err = h.Track(ctx, id, 25, 35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track) != 1 || track[0].DateTime != 30 {
+		t.Fatalf("have %v, want one position at 30", track)
+	}
+	pos, err := h.At(ctx, id, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.DateTime != 25 || pos.Latitude <= 42.921 || pos.Latitude >= 42.922 {
+		t.Fatalf("have %v, want a position between 20 and 30", pos)
+	}
+	if _, err := h.At(ctx, id, 5); !errors.Is(err, ErrHistoryNotFound) {
+		t.Fatalf("have %v, want ErrHistoryNotFound", err)
+	}
+	if err := h.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Track(ctx, id, 0, 0); !errors.Is(err, ErrHistoryNotFound) {
+		t.Fatalf("have %v, want ErrHistoryNotFound", err)
+	}
+}
+
+func TestEngineHistory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithHistory(NewMemoryHistory()),
+	)
+	_, err := engine.AddRule(ctx, `travelled gt 500 { :center 42.9236075 -72.2792333 :radius 5km }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := did("c5vj26evvhfjvfseauk0")
+	route := [][2]float64{
+		{42.9236075, -72.2792333},
+		{42.9236075, -72.2792333},
+		{42.9314328, -72.2812945},
+	}
+	var fired int
+	for _, p := range route {
+		events, _, err := engine.Detect(ctx, makeDevice(id.String(), p[0], p[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fired += len(events)
+		now = now.Add(time.Minute)
+	}
+	if fired != 1 {
+		t.Fatalf("have %d events, want 1", fired)
+	}
+	track, err := engine.Track(ctx, id, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track) != 3 {
+		t.Fatalf("have %d positions, want 3", len(track))
+	}
+	if line := track.LineString(); line.Base().NumPoints() != 3 {
+		t.Fatalf("have %d points, want 3", line.Base().NumPoints())
+	}
+	if track, err := engine.Track(ctx, id, time.Time{}, time.Time{}); err != nil || len(track) != 3 {
+		t.Fatalf("have %d positions, %v, want 3 positions up to now", len(track), err)
+	}
+	pos, err := engine.PositionAt(ctx, id, now.Add(-150*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.Latitude != 42.9236075 {
+		t.Fatalf("have %f, want 42.9236075", pos.Latitude)
+	}
+	if err := engine.DeleteDevice(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Track(ctx, id, now.Add(-time.Hour), now); !errors.Is(err, ErrHistoryNotFound) {
+		t.Fatalf("have %v, want ErrHistoryNotFound", err)
+	}
+}
+
+func TestTrackStoppedFor(t *testing.T) {
+	track := Track{
+		{Latitude: 42.9314328, Longitude: -72.2812945, DateTime: 0},
+		{Latitude: 42.9236075, Longitude: -72.2792333, DateTime: 60},
+		{Latitude: 42.9236080, Longitude: -72.2792330, DateTime: 300},
+		{Latitude: 42.9236075, Longitude: -72.2792333, DateTime: 660},
+	}
+	if have := track.StoppedFor(stopRadiusMeters); have != 10*time.Minute {
+		t.Fatalf("have %s, want 10m", have)
+	}
+	if _, err := NewRule(`stopped gte 10m { :center 42.9236075 -72.2792333 }`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRule(`stopped gte 10 { :center 42.9236075 -72.2792333 }`); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}
+
+func TestEngineTravelledWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithHistory(NewMemoryHistory()),
+	)
+	_, err := engine.AddRule(ctx, `travelled(5m) gt 500 { :center 42.9236075 -72.2792333 :radius 5km }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := did("c5vj26evvhfjvfseauk0")
+	route := []struct {
+		lat, lon float64
+		after    time.Duration
+		events   int
+	}{
+		{42.9236075, -72.2792333, 0, 0},
+		{42.9314328, -72.2812945, time.Minute, 1},
+		// the move is out of the window
+		{42.9314328, -72.2812945, 10 * time.Minute, 0},
+	}
+	for i, p := range route {
+		now = now.Add(p.after)
+		events, _, err := engine.Detect(ctx, makeDevice(id.String(), p.lat, p.lon))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != p.events {
+			t.Fatalf("step %d: have %d events, want %d", i, len(events), p.events)
+		}
+	}
+	for _, spec := range []string{
+		`travelled(5m gt 500 { :center 42.9236075 -72.2792333 }`,
+		`travelled() gt 500 { :center 42.9236075 -72.2792333 }`,
+		`stopped(1h) gte 10m { :center 42.9236075 -72.2792333 }`,
+	} {
+		if _, err := NewRule(spec); err == nil {
+			t.Fatalf("NewRule(%s) => nil, want error", spec)
+		}
+	}
+}
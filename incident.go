@@ -0,0 +1,269 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrIncidentNotFound = errors.New("spinix/incidents: not found")
+
+type IncidentStatus string
+
+const (
+	IncidentOpen         IncidentStatus = "open"
+	IncidentAcknowledged IncidentStatus = "acknowledged"
+	IncidentResolved     IncidentStatus = "resolved"
+)
+
+// Incident follows a rule match of one device from the first event
+// until the condition clears. It is keyed by the StateID of the pair.
+type Incident struct {
+	ID             StateID        `json:"id"`
+	Status         IncidentStatus `json:"status"`
+	OpenedAt       int64          `json:"openedAt"`
+	UpdatedAt      int64          `json:"updatedAt"`
+	AcknowledgedAt int64          `json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy string         `json:"acknowledgedBy,omitempty"`
+	ResolvedAt     int64          `json:"resolvedAt,omitempty"`
+	ResolvedBy     string         `json:"resolvedBy,omitempty"`
+	Updates        int            `json:"updates"`
+	LastEventID    string         `json:"lastEventID"`
+}
+
+func (i *Incident) IsActive() bool {
+	return i.Status != IncidentResolved
+}
+
+type IncidentIterFunc func(ctx context.Context, i *Incident) error
+
+type Incidents interface {
+	Lookup(ctx context.Context, id StateID) (*Incident, error)
+	InsertOrReplace(ctx context.Context, i *Incident) error
+	Delete(ctx context.Context, id StateID) error
+	EachByDevice(ctx context.Context, did DeviceID, fn IncidentIterFunc) error
+	Each(ctx context.Context, fn IncidentIterFunc) error
+}
+
+type incidents struct {
+	sync.RWMutex
+	index    map[StateID]*Incident
+	byDevice map[DeviceID]map[RuleID]struct{}
+}
+
+func NewMemoryIncidents() Incidents {
+	return &incidents{
+		index:    make(map[StateID]*Incident),
+		byDevice: make(map[DeviceID]map[RuleID]struct{}),
+	}
+}
+
+func (s *incidents) Lookup(_ context.Context, id StateID) (*Incident, error) {
+	s.RLock()
+	defer s.RUnlock()
+	incident, ok := s.index[id]
+	if !ok {
+		return nil, fmt.Errorf("%w - %s", ErrIncidentNotFound, id)
+	}
+	copyIncident := *incident
+	return &copyIncident, nil
+}
+
+func (s *incidents) InsertOrReplace(_ context.Context, incident *Incident) error {
+	if err := incident.ID.validate(); err != nil {
+		return err
+	}
+	copyIncident := *incident
+	s.Lock()
+	defer s.Unlock()
+	s.index[incident.ID] = &copyIncident
+	rules, ok := s.byDevice[incident.ID.did]
+	if !ok {
+		rules = make(map[RuleID]struct{})
+		s.byDevice[incident.ID.did] = rules
+	}
+	rules[incident.ID.rid] = struct{}{}
+	return nil
+}
+
+func (s *incidents) Delete(_ context.Context, id StateID) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.index[id]; !ok {
+		return fmt.Errorf("%w - %s", ErrIncidentNotFound, id)
+	}
+	delete(s.index, id)
+	delete(s.byDevice[id.did], id.rid)
+	if len(s.byDevice[id.did]) == 0 {
+		delete(s.byDevice, id.did)
+	}
+	return nil
+}
+
+func (s *incidents) EachByDevice(ctx context.Context, did DeviceID, fn IncidentIterFunc) error {
+	s.RLock()
+	list := make([]Incident, 0, len(s.byDevice[did]))
+	for rid := range s.byDevice[did] {
+		list = append(list, *s.index[StateID{did: did, rid: rid}])
+	}
+	s.RUnlock()
+	for i := range list {
+		if err := fn(ctx, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *incidents) Each(ctx context.Context, fn IncidentIterFunc) error {
+	s.RLock()
+	list := make([]Incident, 0, len(s.index))
+	for _, incident := range s.index {
+		list = append(list, *incident)
+	}
+	s.RUnlock()
+	for i := range list {
+		if err := fn(ctx, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithIncidents enables the incident lifecycle. Detect opens an incident
+// on the first match of a rule, updates it while the rule keeps matching
+// and resolves it once the rule no longer matches the device.
+func WithIncidents() Option {
+	return func(e *Engine) {
+		e.incidents = true
+	}
+}
+
+func WithIncidentsStorage(i Incidents) Option {
+	return func(e *Engine) {
+		e.refs.incidents = i
+	}
+}
+
+func (e *Engine) Incidents() Incidents {
+	return e.refs.incidents
+}
+
+func (e *Engine) AcknowledgeIncident(ctx context.Context, id StateID, by string) (*Incident, error) {
+	incident, err := e.refs.incidents.Lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !incident.IsActive() {
+		return nil, fmt.Errorf("spinix/incidents: incident %s is resolved", id)
+	}
+	incident.Status = IncidentAcknowledged
+	incident.AcknowledgedAt = e.clock.Now().Unix()
+	incident.AcknowledgedBy = by
+	if err := e.refs.incidents.InsertOrReplace(ctx, incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+func (e *Engine) ResolveIncident(ctx context.Context, id StateID, by string) (*Incident, error) {
+	incident, err := e.refs.incidents.Lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !incident.IsActive() {
+		return incident, nil
+	}
+	incident.Status = IncidentResolved
+	incident.ResolvedAt = e.clock.Now().Unix()
+	incident.ResolvedBy = by
+	if err := e.refs.incidents.InsertOrReplace(ctx, incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+// trackIncidents opens or updates the incidents of the matched rules and
+// resolves the other active incidents of the device. Rules whose trigger
+// held back the event keep their incidents while the condition holds.
+func (e *Engine) trackIncidents(ctx context.Context, did DeviceID, matched map[RuleID]string, held map[RuleID]struct{}, now int64) error {
+	for rid, eventID := range matched {
+		sid := StateID{did: did, rid: rid}
+		incident, err := e.refs.incidents.Lookup(ctx, sid)
+		if err != nil && !errors.Is(err, ErrIncidentNotFound) {
+			return err
+		}
+		if incident == nil || !incident.IsActive() {
+			incident = &Incident{
+				ID:       sid,
+				Status:   IncidentOpen,
+				OpenedAt: now,
+			}
+		}
+		incident.UpdatedAt = now
+		incident.Updates++
+		incident.LastEventID = eventID
+		if err := e.refs.incidents.InsertOrReplace(ctx, incident); err != nil {
+			return err
+		}
+	}
+	var cleared []*Incident
+	if err := e.refs.incidents.EachByDevice(ctx, did, func(_ context.Context, incident *Incident) error {
+		if !incident.IsActive() {
+			return nil
+		}
+		if _, ok := matched[incident.ID.rid]; ok {
+			return nil
+		}
+		if _, ok := held[incident.ID.rid]; ok {
+			return nil
+		}
+		cleared = append(cleared, incident)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, incident := range cleared {
+		incident.Status = IncidentResolved
+		incident.ResolvedAt = now
+		incident.UpdatedAt = now
+		if err := e.refs.incidents.InsertOrReplace(ctx, incident); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) deleteDeviceIncidents(ctx context.Context, did DeviceID) error {
+	return e.deleteIncidents(ctx, func(fn IncidentIterFunc) error {
+		return e.refs.incidents.EachByDevice(ctx, did, fn)
+	})
+}
+
+func (e *Engine) deleteRuleIncidents(ctx context.Context, rid RuleID) error {
+	return e.deleteIncidents(ctx, func(fn IncidentIterFunc) error {
+		return e.refs.incidents.Each(ctx, func(ctx context.Context, incident *Incident) error {
+			if incident.ID.rid != rid {
+				return nil
+			}
+			return fn(ctx, incident)
+		})
+	})
+}
+
+func (e *Engine) deleteIncidents(ctx context.Context, each func(fn IncidentIterFunc) error) error {
+	var ids []StateID
+	if err := each(func(_ context.Context, incident *Incident) error {
+		ids = append(ids, incident.ID)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := e.refs.incidents.Delete(ctx, id); err != nil && !errors.Is(err, ErrIncidentNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineIncidents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithIncidents(),
+	)
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	geofence, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heat, err := engine.AddRule(ctx, `temperature gt 30 { :center 42.9236075 -72.2792333 :radius 5km }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := did("c5vj26evvhfjvfseauk0")
+	report := func(lat, lon, temperature float64) {
+		device := makeDevice(id.String(), lat, lon)
+		device.Temperature = temperature
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+	}
+	status := func(rid RuleID) *Incident {
+		incident, err := engine.Incidents().Lookup(ctx, NewStateID(id, rid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return incident
+	}
+
+	report(42.9236075, -72.2792333, 35)
+	report(42.9236075, -72.2792333, 35)
+	if incident := status(geofence.ID()); incident.Status != IncidentOpen || incident.Updates != 2 {
+		t.Fatalf("have %s/%d, want open/2", incident.Status, incident.Updates)
+	}
+	if _, err := engine.AcknowledgeIncident(ctx, NewStateID(id, geofence.ID()), "operator"); err != nil {
+		t.Fatal(err)
+	}
+	// left the polygon, still hot
+	report(42.9314328, -72.2812945, 35)
+	if incident := status(geofence.ID()); incident.Status != IncidentResolved || incident.AcknowledgedBy != "operator" {
+		t.Fatalf("have %s by %q, want resolved after ack", incident.Status, incident.AcknowledgedBy)
+	}
+	if incident := status(heat.ID()); incident.Status != IncidentOpen || incident.Updates != 3 {
+		t.Fatalf("have %s/%d, want open/3", incident.Status, incident.Updates)
+	}
+	if _, err := engine.AcknowledgeIncident(ctx, NewStateID(id, geofence.ID()), "operator"); err == nil {
+		t.Fatal("have nil, want error for a resolved incident")
+	}
+	// far away from every rule
+	report(40.7127753, -74.0059728, 35)
+	if incident := status(heat.ID()); incident.Status != IncidentResolved {
+		t.Fatalf("have %s, want resolved", incident.Status)
+	}
+	// back in the polygon opens a new incident
+	report(42.9236075, -72.2792333, 20)
+	if incident := status(geofence.ID()); incident.Status != IncidentOpen || incident.Updates != 1 {
+		t.Fatalf("have %s/%d, want open/1", incident.Status, incident.Updates)
+	}
+	if err := engine.RemoveRule(ctx, geofence.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Incidents().Lookup(ctx, NewStateID(id, geofence.ID())); err == nil {
+		t.Fatal("have nil, want ErrIncidentNotFound")
+	}
+}
+
+func TestEngineIncidentsTriggerOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithIncidents(),
+	)
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) and speed gt 10 { :trigger once }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := did("c5vj26evvhfjvfseauk0")
+	report := func(speed float64) int {
+		device := makeDevice(id.String(), 42.9236075, -72.2792333)
+		device.Speed = speed
+		events, _, err := engine.Detect(ctx, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+		return len(events)
+	}
+	status := func() IncidentStatus {
+		incident, err := engine.Incidents().Lookup(ctx, NewStateID(id, rule.ID()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return incident.Status
+	}
+	if n := report(20); n != 1 {
+		t.Fatalf("have %d events, want 1", n)
+	}
+	// the trigger holds back the event, the condition still holds
+	if n := report(20); n != 0 || status() != IncidentOpen {
+		t.Fatalf("have %d events, %s, want 0, open", n, status())
+	}
+	// still in the rule cells, the condition clears
+	if n := report(5); n != 0 || status() != IncidentResolved {
+		t.Fatalf("have %d events, %s, want 0, resolved", n, status())
+	}
+}
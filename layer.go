@@ -0,0 +1,106 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rs/xid"
+)
+
+var ErrLayerNotFound = errors.New("spinix/layers: not found")
+
+type LayerIterFunc func(ctx context.Context, l *Layer) error
+
+type Layers interface {
+	Lookup(ctx context.Context, id LayerID) (*Layer, error)
+	InsertOrReplace(ctx context.Context, l *Layer) error
+	Delete(ctx context.Context, id LayerID) error
+	Each(ctx context.Context, fn LayerIterFunc) error
+}
+
+type Layer struct {
+	ID          LayerID `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Owner       string  `json:"owner"`
+}
+
+func NewLayer(name string) *Layer {
+	return &Layer{ID: xid.New(), Name: name}
+}
+
+func (l *Layer) Validate() error {
+	if l == nil {
+		return fmt.Errorf("spinix/layers: layer not specified")
+	}
+	if l.ID.IsNil() {
+		return fmt.Errorf("spinix/layers: layerID not specified")
+	}
+	if len(l.Name) == 0 {
+		return fmt.Errorf("spinix/layers: name not specified")
+	}
+	return nil
+}
+
+type layers struct {
+	index map[LayerID]*Layer
+	sync.RWMutex
+}
+
+func NewMemoryLayers() Layers {
+	return &layers{
+		index: make(map[LayerID]*Layer),
+	}
+}
+
+func (l *layers) Lookup(_ context.Context, id LayerID) (*Layer, error) {
+	if id == DefaultLayer {
+		return &Layer{ID: DefaultLayer, Name: "default"}, nil
+	}
+	l.RLock()
+	defer l.RUnlock()
+	layer, ok := l.index[id]
+	if !ok {
+		return nil, fmt.Errorf("%w - %s", ErrLayerNotFound, id)
+	}
+	copyLayer := *layer
+	return &copyLayer, nil
+}
+
+func (l *layers) InsertOrReplace(_ context.Context, layer *Layer) error {
+	if err := layer.Validate(); err != nil {
+		return err
+	}
+	copyLayer := *layer
+	l.Lock()
+	defer l.Unlock()
+	l.index[layer.ID] = &copyLayer
+	return nil
+}
+
+func (l *layers) Delete(_ context.Context, id LayerID) error {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.index[id]; !ok {
+		return fmt.Errorf("%w - %s", ErrLayerNotFound, id)
+	}
+	delete(l.index, id)
+	return nil
+}
+
+func (l *layers) Each(ctx context.Context, fn LayerIterFunc) error {
+	l.RLock()
+	list := make([]Layer, 0, len(l.index))
+	for _, layer := range l.index {
+		list = append(list, *layer)
+	}
+	l.RUnlock()
+	for i := 0; i < len(list); i++ {
+		if err := fn(ctx, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
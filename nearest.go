@@ -0,0 +1,165 @@
+package spinix
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geo"
+	"github.com/mmadfox/geojson/geometry"
+	"github.com/uber/h3-go"
+)
+
+const maxNearestRings = 64
+
+type (
+	DeviceFilterFunc func(d *Device) bool
+	ObjectFilterFunc func(o *GeoObject) bool
+)
+
+type regionRings struct {
+	origin h3.H3Index
+	lat    float64
+	lon    float64
+	ring   int
+}
+
+func newRegionRings(lat, lon float64, size RegionSize) *regionRings {
+	return &regionRings{
+		origin: H3IndexFromLatLon(lat, lon, size),
+		lat:    lat,
+		lon:    lon,
+	}
+}
+
+// next returns the regions of the next ring and the shortest possible
+// distance from the origin point to any of them.
+func (r *regionRings) next() (regions []RegionID, bound float64, ok bool) {
+	if r.ring > maxNearestRings {
+		return nil, 0, false
+	}
+	ring := r.ring
+	r.ring++
+	if ring == 0 {
+		return []RegionID{RegionID(r.origin)}, 0, true
+	}
+	cells, err := h3.HexRing(r.origin, ring)
+	if err != nil {
+		// pentagon distortion, fall back to the slower k-ring
+		rings := h3.KRingDistances(r.origin, ring)
+		if len(rings) <= ring {
+			return nil, 0, false
+		}
+		cells = rings[ring]
+	}
+	bound = math.MaxFloat64
+	regions = make([]RegionID, 0, len(cells))
+	for _, cell := range cells {
+		regions = append(regions, RegionID(cell))
+		if dist := r.distanceToCell(cell); dist < bound {
+			bound = dist
+		}
+	}
+	return regions, bound, true
+}
+
+func (r *regionRings) distanceToCell(cell h3.H3Index) float64 {
+	center := h3.ToGeo(cell)
+	var radius float64
+	for _, vertex := range h3.ToGeoBoundary(cell) {
+		dist := geo.DistanceTo(center.Latitude, center.Longitude, vertex.Latitude, vertex.Longitude)
+		if dist > radius {
+			radius = dist
+		}
+	}
+	dist := geo.DistanceTo(r.lat, r.lon, center.Latitude, center.Longitude) - radius
+	if dist < 0 {
+		return 0
+	}
+	return dist
+}
+
+func validateNearest(lat, lon float64, k int) error {
+	if k <= 0 {
+		return fmt.Errorf("spinix/nearest: k must be greater than zero")
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("spinix/nearest: invalid coordinates %f %f", lat, lon)
+	}
+	return nil
+}
+
+func distanceToObject(data geojson.Object, lat, lon float64) float64 {
+	point := geometry.Point{X: lat, Y: lon}
+	if data.Intersects(geojson.NewPoint(point)) {
+		return 0
+	}
+	dist := math.MaxFloat64
+	data.ForEach(func(geom geojson.Object) bool {
+		var d float64
+		switch g := geom.(type) {
+		case *geojson.Point:
+			d = geo.DistanceTo(lat, lon, g.Base().X, g.Base().Y)
+		case *geojson.SimplePoint:
+			d = geo.DistanceTo(lat, lon, g.Base().X, g.Base().Y)
+		case *geojson.LineString:
+			d = distanceToSeries(g.Base(), point)
+		case *geojson.Polygon:
+			d = distanceToSeries(g.Base().Exterior, point)
+			for _, hole := range g.Base().Holes {
+				d = math.Min(d, distanceToSeries(hole, point))
+			}
+		case *geojson.Rect:
+			rect := g.Base()
+			d = distanceToSeries(geometry.NewPoly([]geometry.Point{
+				rect.Min, {X: rect.Max.X, Y: rect.Min.Y},
+				rect.Max, {X: rect.Min.X, Y: rect.Max.Y}, rect.Min,
+			}, nil, nil).Exterior, point)
+		default:
+			center := geom.Center()
+			d = geo.DistanceTo(lat, lon, center.X, center.Y)
+		}
+		if d < dist {
+			dist = d
+		}
+		return true
+	})
+	return dist
+}
+
+func distanceToSeries(series geometry.Series, p geometry.Point) float64 {
+	dist := math.MaxFloat64
+	for i := 0; i < series.NumSegments(); i++ {
+		seg := series.SegmentAt(i)
+		nearest := nearestOnSegment(seg, p)
+		if d := geo.DistanceTo(p.X, p.Y, nearest.X, nearest.Y); d < dist {
+			dist = d
+		}
+	}
+	return dist
+}
+
+// nearestOnSegment projects the point onto the segment in a local
+// equirectangular plane, which is accurate enough at region scale.
+func nearestOnSegment(seg geometry.Segment, p geometry.Point) geometry.Point {
+	k := math.Cos(p.X * math.Pi / 180)
+	ax, ay := seg.A.X, seg.A.Y*k
+	bx, by := seg.B.X, seg.B.Y*k
+	px, py := p.X, p.Y*k
+	dx, dy := bx-ax, by-ay
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return seg.A
+	}
+	t := ((px-ax)*dx + (py-ay)*dy) / length
+	switch {
+	case t <= 0:
+		return seg.A
+	case t >= 1:
+		return seg.B
+	}
+	return geometry.Point{
+		X: seg.A.X + t*(seg.B.X-seg.A.X),
+		Y: seg.A.Y + t*(seg.B.Y-seg.A.Y),
+	}
+}
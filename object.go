@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/rs/xid"
@@ -26,8 +27,14 @@ type ObjectIterFunc func(ctx context.Context, o *GeoObject) error
 type Objects interface {
 	Lookup(ctx context.Context, oid ObjectID) (*GeoObject, error)
 	Add(ctx context.Context, o *GeoObject) error
+	Update(ctx context.Context, o *GeoObject) error
 	Delete(ctx context.Context, oid ObjectID) error
 	Each(ctx context.Context, lid LayerID, rid RegionID, fn ObjectIterFunc) error
+	EachLayer(ctx context.Context, lid LayerID, fn ObjectIterFunc) error
+	Count(ctx context.Context, lid LayerID) (int, error)
+	DeleteLayer(ctx context.Context, lid LayerID) (int, error)
+	Search(ctx context.Context, lid LayerID, query geojson.Object, p SearchPredicate, fn ObjectIterFunc) error
+	Nearest(ctx context.Context, lat, lon float64, k int, filter ObjectFilterFunc) ([]*GeoObject, error)
 	Near(ctx context.Context, lid LayerID, lat, lon, meters float64, fn ObjectIterFunc) error
 }
 
@@ -50,14 +57,37 @@ func NewGeoObject(oid ObjectID, lid LayerID, data geojson.Object) *GeoObject {
 	dist := geo.DistanceTo(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y)
 	meters := normalizeDistance(dist/2, SmallRegionSize)
 	ri := regionsFromLatLon(rect.Center().X, rect.Center().Y, meters, SmallRegionSize)
+	// the center and the corners put the object into the regions
+	// a point lookup searches
+	regions := RegionIDs([]geometry.Point{
+		rect.Center(),
+		rect.Min,
+		rect.Max,
+		{X: rect.Min.X, Y: rect.Max.Y},
+		{X: rect.Max.X, Y: rect.Min.Y},
+	}, SmallRegionSize)
+	for _, rid := range ri.regions {
+		if !containsRegionID(regions, rid) {
+			regions = append(regions, rid)
+		}
+	}
 	return &GeoObject{
 		id:   oid,
 		lid:  lid,
 		data: data,
-		rid:  ri.regions,
+		rid:  regions,
 	}
 }
 
+func containsRegionID(ids []RegionID, id RegionID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (o *GeoObject) RegionSize() RegionSize {
 	return SmallRegionSize
 }
@@ -104,12 +134,14 @@ func NewMemoryObjects() Objects {
 	return &objects{
 		hashIndex:   newObjectsHashIndex(),
 		regionIndex: newObjectRegionIndex(),
+		layerIndex:  newObjectLayerIndex(),
 	}
 }
 
 type objects struct {
 	hashIndex   objectHashIndex
 	regionIndex *objectRegionIndex
+	layerIndex  *objectLayerIndex
 }
 
 func (o *objects) Near(ctx context.Context, lid LayerID, lat, lon, meters float64, fn ObjectIterFunc) error {
@@ -150,6 +182,132 @@ func (o *objects) Near(ctx context.Context, lid LayerID, lat, lon, meters float6
 	return nil
 }
 
+func (o *objects) Search(ctx context.Context, lid LayerID, query geojson.Object, p SearchPredicate, fn ObjectIterFunc) error {
+	if err := validateSearch(query, p); err != nil {
+		return err
+	}
+	bbox := query.Rect()
+	visited := make(map[ObjectID]struct{})
+	var found []*GeoObject
+	for _, region := range o.regionIndex.list() {
+		region.mu.RLock()
+		region.index.Search(
+			[2]float64{bbox.Min.X, bbox.Min.Y},
+			[2]float64{bbox.Max.X, bbox.Max.Y},
+			func(min, max [2]float64, value interface{}) bool {
+				obj := value.(*GeoObject)
+				if obj.Layer() != lid {
+					return true
+				}
+				if _, ok := visited[obj.ID()]; ok {
+					return true
+				}
+				visited[obj.ID()] = struct{}{}
+				if p.match(obj.Data(), query) {
+					found = append(found, obj)
+				}
+				return true
+			},
+		)
+		region.mu.RUnlock()
+	}
+	for _, obj := range found {
+		if err := fn(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectLocator finds the objects that contain a point.
+type objectLocator interface {
+	at(lid LayerID, lat, lon float64, fn func(*GeoObject))
+}
+
+// at searches only the region that contains the point.
+func (o *objects) at(lid LayerID, lat, lon float64, fn func(*GeoObject)) {
+	region, err := o.regionIndex.regionByID(RegionFromLatLon(lat, lon, SmallRegionSize))
+	if err != nil {
+		return
+	}
+	point := geojson.NewPoint(geometry.Point{X: lat, Y: lon})
+	var found []*GeoObject
+	region.mu.RLock()
+	region.index.Search(
+		[2]float64{lat, lon},
+		[2]float64{lat, lon},
+		func(min, max [2]float64, value interface{}) bool {
+			obj := value.(*GeoObject)
+			if obj.Layer() == lid && SearchIntersects.match(obj.Data(), point) {
+				found = append(found, obj)
+			}
+			return true
+		},
+	)
+	region.mu.RUnlock()
+	for _, obj := range found {
+		fn(obj)
+	}
+}
+
+func (o *objects) Nearest(ctx context.Context, lat, lon float64, k int, filter ObjectFilterFunc) ([]*GeoObject, error) {
+	if err := validateNearest(lat, lon, k); err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		object   *GeoObject
+		distance float64
+	}
+	var found []candidate
+	seen := make(map[ObjectID]struct{})
+	total := o.regionIndex.size()
+	visited := 0
+	rings := newRegionRings(lat, lon, SmallRegionSize)
+	regions, _, ok := rings.next()
+	for ok && visited < total {
+		for _, rid := range regions {
+			region, err := o.regionIndex.regionByID(rid)
+			if err != nil {
+				continue
+			}
+			visited++
+			region.all(func(obj *GeoObject) bool {
+				if _, ok := seen[obj.ID()]; ok {
+					return true
+				}
+				seen[obj.ID()] = struct{}{}
+				if filter != nil && !filter(obj) {
+					return true
+				}
+				found = append(found, candidate{
+					object:   obj,
+					distance: distanceToObject(obj.Data(), lat, lon),
+				})
+				return true
+			})
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].distance < found[j].distance
+		})
+		var bound float64
+		regions, bound, ok = rings.next()
+		if len(found) >= k && found[k-1].distance <= bound {
+			break
+		}
+	}
+	if len(found) > k {
+		found = found[:k]
+	}
+	list := make([]*GeoObject, len(found))
+	for i := 0; i < len(found); i++ {
+		list[i] = found[i].object
+	}
+	return list, nil
+}
+
 func (o *objects) Each(ctx context.Context, lid LayerID, rid RegionID, fn ObjectIterFunc) error {
 	region, err := o.regionIndex.regionByID(rid)
 	if err != nil {
@@ -174,40 +332,143 @@ func (o *objects) Add(_ context.Context, obj *GeoObject) error {
 	if err == nil && last != nil {
 		return fmt.Errorf("spinix/objects: object %s already refExists", obj.ID())
 	}
+	o.insertRegions(obj)
+	o.hashIndex.set(obj)
+	o.layerIndex.set(obj)
+	return nil
+}
+
+func (o *objects) Update(_ context.Context, obj *GeoObject) error {
+	prevState, err := o.hashIndex.get(obj.ID())
+	if err != nil {
+		return err
+	}
+	o.insertRegions(obj)
+	o.hashIndex.set(obj)
+	o.layerIndex.delete(prevState)
+	o.layerIndex.set(obj)
+	o.deleteRegions(prevState)
+	return nil
+}
+
+func (o *objects) insertRegions(obj *GeoObject) {
 	for _, regionID := range obj.RegionID() {
 		region, err := o.regionIndex.regionByID(regionID)
 		if err != nil {
 			region = o.regionIndex.newRegion(regionID)
-			if region != nil {
-				err = nil
-			}
 		}
 		region.insert(obj)
 	}
-	o.hashIndex.set(obj)
-	return nil
 }
 
-func (o *objects) Delete(_ context.Context, id ObjectID) error {
-	prevState, err := o.hashIndex.get(id)
-	if err != nil {
-		return err
-	}
-	for _, rid := range prevState.RegionID() {
+func (o *objects) deleteRegions(obj *GeoObject) {
+	for _, rid := range obj.RegionID() {
 		region, err := o.regionIndex.regionByID(rid)
-		// not found
 		if err != nil {
-			return nil
+			continue
 		}
-		region.delete(prevState)
+		region.delete(obj)
 		if region.isEmpty() {
 			o.regionIndex.delete(rid)
 		}
 	}
+}
+
+func (o *objects) Delete(_ context.Context, id ObjectID) error {
+	prevState, err := o.hashIndex.get(id)
+	if err != nil {
+		return err
+	}
+	o.deleteRegions(prevState)
 	o.hashIndex.delete(id)
+	o.layerIndex.delete(prevState)
+	return nil
+}
+
+func (o *objects) EachLayer(ctx context.Context, lid LayerID, fn ObjectIterFunc) error {
+	for _, obj := range o.layerIndex.list(lid) {
+		if err := fn(ctx, obj); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (o *objects) Count(_ context.Context, lid LayerID) (int, error) {
+	return o.layerIndex.count(lid), nil
+}
+
+func (o *objects) DeleteLayer(ctx context.Context, lid LayerID) (n int, err error) {
+	for _, obj := range o.layerIndex.list(lid) {
+		if err = o.Delete(ctx, obj.ID()); err != nil {
+			if errors.Is(err, ErrObjectNotFound) {
+				continue
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (o *objects) scan(fn func(*GeoObject)) {
+	for _, bucket := range o.hashIndex {
+		bucket.RLock()
+		for _, obj := range bucket.index {
+			fn(obj)
+		}
+		bucket.RUnlock()
+	}
+}
+
+type objectLayerIndex struct {
+	layers map[LayerID]map[ObjectID]*GeoObject
+	sync.RWMutex
+}
+
+func newObjectLayerIndex() *objectLayerIndex {
+	return &objectLayerIndex{
+		layers: make(map[LayerID]map[ObjectID]*GeoObject),
+	}
+}
+
+func (li *objectLayerIndex) set(obj *GeoObject) {
+	li.Lock()
+	defer li.Unlock()
+	if li.layers[obj.lid] == nil {
+		li.layers[obj.lid] = make(map[ObjectID]*GeoObject)
+	}
+	li.layers[obj.lid][obj.id] = obj
+}
+
+func (li *objectLayerIndex) delete(obj *GeoObject) {
+	li.Lock()
+	defer li.Unlock()
+	if li.layers[obj.lid][obj.id] != obj {
+		return
+	}
+	delete(li.layers[obj.lid], obj.id)
+	if len(li.layers[obj.lid]) == 0 {
+		delete(li.layers, obj.lid)
+	}
+}
+
+func (li *objectLayerIndex) count(lid LayerID) int {
+	li.RLock()
+	defer li.RUnlock()
+	return len(li.layers[lid])
+}
+
+func (li *objectLayerIndex) list(lid LayerID) []*GeoObject {
+	li.RLock()
+	defer li.RUnlock()
+	list := make([]*GeoObject, 0, len(li.layers[lid]))
+	for _, obj := range li.layers[lid] {
+		list = append(list, obj)
+	}
+	return list
+}
+
 type objectHashIndex []*objectBucket
 
 type objectBucket struct {
@@ -245,7 +506,7 @@ func (i objectHashIndex) get(id ObjectID) (*GeoObject, error) {
 	defer bucket.RUnlock()
 	object, ok := bucket.index[id]
 	if !ok {
-		return nil, fmt.Errorf("spinix/objects: object %s not found", id)
+		return nil, fmt.Errorf("%w - %s", ErrObjectNotFound, id)
 	}
 	return object, nil
 }
@@ -279,6 +540,22 @@ func (ri *objectRegionIndex) delete(rid RegionID) {
 	delete(ri.regions, rid)
 }
 
+func (ri *objectRegionIndex) size() int {
+	ri.RLock()
+	defer ri.RUnlock()
+	return len(ri.regions)
+}
+
+func (ri *objectRegionIndex) list() []*objectRegion {
+	ri.RLock()
+	defer ri.RUnlock()
+	regions := make([]*objectRegion, 0, len(ri.regions))
+	for _, region := range ri.regions {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
 func (ri *objectRegionIndex) regionByID(rid RegionID) (*objectRegion, error) {
 	ri.RLock()
 	defer ri.RUnlock()
@@ -320,9 +597,11 @@ func (o *objectRegion) delete(obj *GeoObject) {
 		[2]float64{bbox.Min.X, bbox.Min.Y},
 		[2]float64{bbox.Max.X, bbox.Max.Y},
 		obj)
-	delete(o.layer[obj.lid], obj.id)
+	if o.layer[obj.lid][obj.id] == obj {
+		delete(o.layer[obj.lid], obj.id)
+	}
 	if len(o.layer[obj.lid]) == 0 {
-		o.layer = make(map[LayerID]map[ObjectID]*GeoObject)
+		delete(o.layer, obj.lid)
 	}
 }
 
@@ -346,6 +625,18 @@ func (o *objectRegion) each(lid LayerID, fn func(*GeoObject) bool) {
 	}
 }
 
+func (o *objectRegion) all(fn func(*GeoObject) bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, objects := range o.layer {
+		for _, obj := range objects {
+			if ok := fn(obj); !ok {
+				return
+			}
+		}
+	}
+}
+
 func (o *objectRegion) insert(obj *GeoObject) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
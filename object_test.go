@@ -4,7 +4,9 @@ import (
 	"context"
 	"testing"
 
+	"github.com/mmadfox/geojson"
 	"github.com/mmadfox/geojson/geometry"
+	"github.com/rs/xid"
 )
 
 func TestObjectsNear(t *testing.T) {
@@ -52,3 +54,151 @@ func TestObjectsNear(t *testing.T) {
 		t.Fatalf("have %d, want %d found objects", found, want)
 	}
 }
+
+func TestObjectsLayer(t *testing.T) {
+	objects := NewMemoryObjects()
+	ctx := context.Background()
+	layer := xid.New()
+	for i := 0; i < 3; i++ {
+		if err := objects.Add(ctx, NewGeoObjectWithID(layer, polyFromString(testPolyCoords))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := objects.Add(ctx, NewGeoObjectWithID(DefaultLayer, polyFromString(testPolyCoords))); err != nil {
+		t.Fatal(err)
+	}
+	count, err := objects.Count(ctx, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("have %d, want 3 objects", count)
+	}
+	var found int
+	if err := objects.EachLayer(ctx, layer, func(ctx context.Context, o *GeoObject) error {
+		if o.Layer() != layer {
+			t.Fatalf("have %s, want %s layer", o.Layer(), layer)
+		}
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 3 {
+		t.Fatalf("have %d, want 3 objects", found)
+	}
+	deleted, err := objects.DeleteLayer(ctx, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Fatalf("have %d, want 3 deleted objects", deleted)
+	}
+	if count, _ := objects.Count(ctx, layer); count != 0 {
+		t.Fatalf("have %d, want 0 objects", count)
+	}
+	if count, _ := objects.Count(ctx, DefaultLayer); count != 1 {
+		t.Fatalf("have %d, want 1 object", count)
+	}
+}
+
+func TestObjectsSearch(t *testing.T) {
+	objects := NewMemoryObjects()
+	ctx := context.Background()
+	object := NewGeoObjectWithID(DefaultLayer, polyFromString(testPolyCoords))
+	if err := objects.Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if err := objects.Add(ctx, NewGeoObjectWithID(xid.New(), polyFromString(testPolyCoords))); err != nil {
+		t.Fatal(err)
+	}
+	area := geojson.NewRect(geometry.Rect{
+		Min: geometry.Point{X: 42.92, Y: -72.29},
+		Max: geometry.Point{X: 42.93, Y: -72.27},
+	})
+	inner := geojson.NewRect(geometry.Rect{
+		Min: geometry.Point{X: 42.9235, Y: -72.2796},
+		Max: geometry.Point{X: 42.9236, Y: -72.2795},
+	})
+	outer := geojson.NewRect(geometry.Rect{
+		Min: geometry.Point{X: 42.95, Y: -72.29},
+		Max: geometry.Point{X: 42.96, Y: -72.27},
+	})
+	testCases := []struct {
+		query     geojson.Object
+		predicate SearchPredicate
+		want      int
+	}{
+		{query: area, predicate: SearchIntersects, want: 1},
+		{query: area, predicate: SearchWithin, want: 1},
+		{query: area, predicate: SearchContains, want: 0},
+		{query: inner, predicate: SearchContains, want: 1},
+		{query: inner, predicate: SearchWithin, want: 0},
+		{query: outer, predicate: SearchIntersects, want: 0},
+	}
+	for _, tc := range testCases {
+		var found int
+		if err := objects.Search(ctx, DefaultLayer, tc.query, tc.predicate,
+			func(ctx context.Context, o *GeoObject) error {
+				if o.ID() != object.ID() {
+					t.Fatalf("have %s, want %s object", o.ID(), object.ID())
+				}
+				found++
+				return nil
+			}); err != nil {
+			t.Fatal(err)
+		}
+		if found != tc.want {
+			t.Fatalf("%s: have %d, want %d objects", tc.predicate, found, tc.want)
+		}
+	}
+}
+
+func TestObjectsNearest(t *testing.T) {
+	objects := NewMemoryObjects()
+	ctx := context.Background()
+	inside := NewGeoObjectWithID(DefaultLayer, polyFromString(testPolyCoords))
+	near := NewGeoObjectWithID(DefaultLayer, polyFromString(`
+-72.2795102, 42.9284065
+-72.2792367, 42.9279783
+-72.2782391, 42.9280805
+-72.2788452, 42.9286029
+-72.2795048, 42.9284261
+-72.2795102, 42.9284065
+`))
+	far := NewGeoObjectWithID(DefaultLayer, polyFromString(`
+-71.2795102, 43.9284065
+-71.2792367, 43.9279783
+-71.2782391, 43.9280805
+-71.2788452, 43.9286029
+-71.2795048, 43.9284261
+-71.2795102, 43.9284065
+`))
+	for _, object := range []*GeoObject{far, near, inside} {
+		if err := objects.Add(ctx, object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, err := objects.Nearest(ctx, 42.9236, -72.2795, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ObjectID{inside.ID(), near.ID(), far.ID()}
+	if len(found) != len(want) {
+		t.Fatalf("have %d, want %d objects", len(found), len(want))
+	}
+	for i := range found {
+		if found[i].ID() != want[i] {
+			t.Fatalf("have %s, want %s at %d", found[i].ID(), want[i], i)
+		}
+	}
+	found, err = objects.Nearest(ctx, 42.9236, -72.2795, 1, func(o *GeoObject) bool {
+		return o.ID() != inside.ID()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID() != near.ID() {
+		t.Fatalf("have %v, want [%s]", found, near.ID())
+	}
+}
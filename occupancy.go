@@ -0,0 +1,268 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geometry"
+	"github.com/rs/xid"
+)
+
+var ErrOccupancyDisabled = errors.New("spinix/occupancy: disabled")
+
+// WithOccupancy enables live occupancy counters. Detect keeps, for every
+// object of the device layer, the set of devices whose last report lies
+// inside it. Counters are kept in memory, New and Restore count the
+// stored devices again.
+func WithOccupancy() Option {
+	return func(e *Engine) {
+		e.refs.occupancy = newOccupancy()
+	}
+}
+
+// Occupancy returns the number of devices inside the object.
+func (e *Engine) Occupancy(_ context.Context, id ObjectID) (int, error) {
+	if e.refs.occupancy == nil {
+		return 0, ErrOccupancyDisabled
+	}
+	return e.refs.occupancy.count(id), nil
+}
+
+// Occupants returns the devices inside the object ordered by ID.
+func (e *Engine) Occupants(_ context.Context, id ObjectID) ([]DeviceID, error) {
+	if e.refs.occupancy == nil {
+		return nil, ErrOccupancyDisabled
+	}
+	return e.refs.occupancy.occupants(id), nil
+}
+
+func (e *Engine) updateOccupancy(ctx context.Context, d *Device) error {
+	inside, err := e.objectsAt(ctx, d.Layer, PositionFromDevice(d))
+	if err != nil {
+		return err
+	}
+	e.refs.occupancy.update(d.ID, inside)
+	return nil
+}
+
+// rebuildOccupancy counts the devices from their stored positions.
+func (e *Engine) rebuildOccupancy(ctx context.Context) error {
+	if e.refs.occupancy == nil {
+		return nil
+	}
+	scanner, ok := e.refs.devices.(deviceScanner)
+	if !ok {
+		return nil
+	}
+	var devices []Device
+	scanner.scan(func(d *Device) {
+		devices = append(devices, *d)
+	})
+	for i := range devices {
+		if err := e.updateOccupancy(ctx, &devices[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshOccupancy drops the occupants that are no longer inside the
+// updated object. Devices that moved into it are counted on their next report.
+func (e *Engine) refreshOccupancy(ctx context.Context, o *GeoObject) error {
+	for _, did := range e.refs.occupancy.occupants(o.ID()) {
+		device, err := e.refs.devices.Lookup(ctx, did)
+		if err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			return err
+		}
+		if device != nil && device.Layer == o.lid {
+			point := geojson.NewPoint(geometry.Point{X: device.Latitude, Y: device.Longitude})
+			if SearchIntersects.match(o.data, point) {
+				continue
+			}
+		}
+		e.refs.occupancy.leave(o.ID(), did)
+	}
+	return nil
+}
+
+type occupancy struct {
+	sync.RWMutex
+	objects map[ObjectID]map[DeviceID]struct{}
+	devices map[DeviceID][]ObjectID
+}
+
+func newOccupancy() *occupancy {
+	return &occupancy{
+		objects: make(map[ObjectID]map[DeviceID]struct{}),
+		devices: make(map[DeviceID][]ObjectID),
+	}
+}
+
+func (o *occupancy) update(did DeviceID, inside []ObjectID) {
+	o.Lock()
+	defer o.Unlock()
+	for _, oid := range o.devices[did] {
+		if !containsObjectID(inside, oid) {
+			o.remove(oid, did)
+		}
+	}
+	for _, oid := range inside {
+		devices, ok := o.objects[oid]
+		if !ok {
+			devices = make(map[DeviceID]struct{})
+			o.objects[oid] = devices
+		}
+		devices[did] = struct{}{}
+	}
+	if len(inside) == 0 {
+		delete(o.devices, did)
+	} else {
+		o.devices[did] = inside
+	}
+}
+
+func (o *occupancy) leave(oid ObjectID, did DeviceID) {
+	o.Lock()
+	defer o.Unlock()
+	o.remove(oid, did)
+	o.forget(did, oid)
+}
+
+func (o *occupancy) deleteDevice(did DeviceID) {
+	o.Lock()
+	defer o.Unlock()
+	for _, oid := range o.devices[did] {
+		o.remove(oid, did)
+	}
+	delete(o.devices, did)
+}
+
+func (o *occupancy) deleteObject(oid ObjectID) {
+	o.Lock()
+	defer o.Unlock()
+	for did := range o.objects[oid] {
+		o.forget(did, oid)
+	}
+	delete(o.objects, oid)
+}
+
+// remove deletes the device from the occupants of the object.
+func (o *occupancy) remove(oid ObjectID, did DeviceID) {
+	delete(o.objects[oid], did)
+	if len(o.objects[oid]) == 0 {
+		delete(o.objects, oid)
+	}
+}
+
+// forget deletes the object from the objects the device is inside.
+func (o *occupancy) forget(did DeviceID, oid ObjectID) {
+	objects := o.devices[did][:0]
+	for _, id := range o.devices[did] {
+		if id != oid {
+			objects = append(objects, id)
+		}
+	}
+	if len(objects) == 0 {
+		delete(o.devices, did)
+	} else {
+		o.devices[did] = objects
+	}
+}
+
+func (o *occupancy) count(oid ObjectID) int {
+	o.RLock()
+	defer o.RUnlock()
+	return len(o.objects[oid])
+}
+
+func (o *occupancy) occupants(oid ObjectID) []DeviceID {
+	o.RLock()
+	ids := make([]DeviceID, 0, len(o.objects[oid]))
+	for did := range o.objects[oid] {
+		ids = append(ids, did)
+	}
+	o.RUnlock()
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+	return ids
+}
+
+func containsObjectID(ids []ObjectID, id ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *spec) hasOccupancy() bool {
+	for _, node := range s.nodes {
+		if _, ok := node.(occupancyOp); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type occupancyOp struct {
+	object *ObjectLit
+	value  int
+	op     Token
+	pos    Pos
+}
+
+func (n occupancyOp) refIDs() (refs map[xid.ID]Token) {
+	refs = make(map[xid.ID]Token, len(n.object.Ref))
+	for _, id := range n.object.Ref {
+		refs[id] = n.object.Kind
+	}
+	return
+}
+
+// evaluate matches when the occupancy of any of the objects satisfies
+// the condition. The matching objects are reported as the left refs.
+func (n occupancyOp) evaluate(_ context.Context, _ *Device, _ *State, r reference, _ *specProps) (match Match, err error) {
+	match.Left.Keyword = OCCUPANCY
+	match.Right.Keyword = INT
+	match.Operator = n.op
+	match.Pos = n.pos
+	if r.occupancy == nil {
+		return
+	}
+	for _, id := range n.object.Ref {
+		count := r.occupancy.count(id)
+		var ok bool
+		switch n.op {
+		case EQ:
+			ok = count == n.value
+		case LT:
+			ok = count < n.value
+		case GT:
+			ok = count > n.value
+		case NE:
+			ok = count != n.value
+		case LTE:
+			ok = count <= n.value
+		case GTE:
+			ok = count >= n.value
+		}
+		if ok {
+			match.Left.Refs = append(match.Left.Refs, id)
+		}
+	}
+	match.Ok = len(match.Left.Refs) > 0
+	return
+}
+
+func (e *Engine) validateOccupancy(rule *Rule) error {
+	if e.refs.occupancy == nil && rule.spec.hasOccupancy() {
+		return fmt.Errorf("%w - rule [%s] uses occupancy", ErrOccupancyDisabled, rule.specStr)
+	}
+	return nil
+}
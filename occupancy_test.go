@@ -0,0 +1,105 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEngineOccupancy(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithOccupancy())
+	yard := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, yard); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, `occupancy(polygon(c5vj26evvhfjvfseaulg)) gt 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detect := func(id string, lat, lon float64) []Event {
+		events, _, err := engine.Detect(ctx, makeDevice(id, lat, lon))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	if events := detect("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333); len(events) != 0 {
+		t.Fatalf("have %d events, want 0", len(events))
+	}
+	events := detect("c5vj26evvhfjvfseaukg", 42.9236075, -72.2792333)
+	if len(events) != 1 {
+		t.Fatalf("have %d events, want 1", len(events))
+	}
+	if events[0].Rule.RuleID != rule.ID().String() || events[0].Match[0].Left.Refs[0] != yard.ID() {
+		t.Fatalf("have %v, want match of yard", events[0])
+	}
+	occupants, err := engine.Occupants(ctx, yard.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occupants) != 2 || occupants[0].String() != "c5vj26evvhfjvfseauk0" {
+		t.Fatalf("have %v, want 2 occupants", occupants)
+	}
+
+	// leaving the yard
+	detect("c5vj26evvhfjvfseauk0", 42.9314328, -72.2812945)
+	if n, _ := engine.Occupancy(ctx, yard.ID()); n != 1 {
+		t.Fatalf("have %d occupants, want 1", n)
+	}
+	if err := engine.DeleteDevice(ctx, occupants[1]); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := engine.Occupancy(ctx, yard.ID()); n != 0 {
+		t.Fatalf("have %d occupants, want 0", n)
+	}
+}
+
+func TestEngineOccupancyDisabled(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	yard := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, yard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `occupancy(polygon(c5vj26evvhfjvfseaulg)) gt 1`); !errors.Is(err, ErrOccupancyDisabled) {
+		t.Fatalf("have %v, want %v", err, ErrOccupancyDisabled)
+	}
+	if _, err := engine.Occupants(ctx, yard.ID()); !errors.Is(err, ErrOccupancyDisabled) {
+		t.Fatalf("have %v, want %v", err, ErrOccupancyDisabled)
+	}
+}
+
+func TestEngineOccupancyRestart(t *testing.T) {
+	ctx := context.Background()
+	storage, err := OpenDiskStorage(t.TempDir(), WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(WithDiskStorage(storage), WithOccupancy())
+	yard := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, yard); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c5vj26evvhfjvfseauk0", "c5vj26evvhfjvfseaukg"} {
+		if _, _, err := engine.Detect(ctx, makeDevice(id, 42.9236075, -72.2792333)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// outside of the yard
+	if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseaul0", 42.9314328, -72.2812945)); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	storage, err = OpenDiskStorage(storage.dir, WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	engine = New(WithDiskStorage(storage), WithOccupancy())
+	if n, _ := engine.Occupancy(ctx, yard.ID()); n != 2 {
+		t.Fatalf("have %d occupants, want 2", n)
+	}
+}
@@ -3,6 +3,7 @@ package spinix
 import (
 	"fmt"
 	"math"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -110,6 +111,10 @@ func (p *Parser) parseProps(expr Expr) (Expr, error) {
 			prop, err = p.parseTriggerProp()
 		case RESET:
 			prop, err = p.parseResetProp()
+		case WEBHOOK:
+			prop, err = p.parseWebhookProp()
+		case MAXAGE:
+			prop, err = p.parseMaxAgeProp()
 		default:
 			return nil, p.error(tok, lit, "ILLEGAL")
 		}
@@ -139,6 +144,45 @@ func (p *Parser) parseLayerProp() (Expr, error) {
 	}, nil
 }
 
+func (p *Parser) parseWebhookProp() (Expr, error) {
+	tok, lit := p.s.Next()
+	if tok != STRING {
+		return nil, p.error(tok, lit, fmt.Sprintf("got %v, expected %v", tok, STRING))
+	}
+	lit = strings.Trim(lit, `"`)
+	u, err := url.Parse(lit)
+	if err != nil {
+		return nil, p.error(tok, lit, err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, p.error(tok, lit, "expected http or https url")
+	}
+	return &BaseLit{
+		Kind: WEBHOOK,
+		Expr: &StringLit{Value: lit, Pos: p.s.Offset()},
+		Pos:  p.s.Offset(),
+	}, nil
+}
+
+func (p *Parser) parseMaxAgeProp() (Expr, error) {
+	dur, err := p.parseTimeDuration()
+	if err != nil {
+		return nil, p.error(MAXAGE, ":maxage", err.Error())
+	}
+	if dur <= 0 {
+		return nil, p.error(MAXAGE, ":maxage", "expected positive duration")
+	}
+	return &BaseLit{
+		Kind: MAXAGE,
+		Expr: &DurationLit{
+			Kind:  DURATION,
+			Value: dur,
+			Pos:   p.s.Offset(),
+		},
+		Pos: p.s.Offset(),
+	}, nil
+}
+
 func (p *Parser) parseExpireProp() (Expr, error) {
 	dur, err := p.parseTimeDuration()
 	if err != nil {
@@ -316,12 +360,20 @@ func (p *Parser) parseExpr() (Expr, error) {
 		return p.parseDeviceLit()
 	case DEVICES:
 		return p.parseDevicesLit()
+	case SILENCE:
+		return p.parseSilenceLit()
+	case OCCUPANCY:
+		return p.parseOccupancyLit()
+	case CONVOY:
+		return p.parseConvoyLit()
 	case OBJECTS, POLY, MULTI_POLY, LINE, MULTI_LINE,
 		POINT, MULTI_POINT, RECT, CIRCLE, COLLECTION, FUT_COLLECTION:
 		return p.parseObjectLit(tok)
 	case FUELLEVEL, PRESSURE, LUMINOSITY, HUMIDITY, TEMPERATURE, BATTERY_CHARGE,
 		STATUS, SPEED, MODEL, BRAND, OWNER, IMEI, YEAR, MONTH, WEEK, DAY, HOUR, TIME, DATETIME, DATE:
 		return &IdentLit{Name: lit, Pos: p.s.Offset(), Kind: tok}, nil
+	case TRAVELLED, STOPPED:
+		return p.parseTrackLit(tok)
 	default:
 		return nil, p.error(tok, lit, "ILLEGAL")
 	}
@@ -371,6 +423,108 @@ func (p *Parser) parseDevicesLit() (Expr, error) {
 	return devices, nil
 }
 
+func (p *Parser) parseSilenceLit() (Expr, error) {
+	silence := &SilenceLit{All: true}
+	if tok := p.s.NextTok(); tok != LPAREN {
+		silence.Pos = p.s.Offset()
+		p.s.Reset()
+		return silence, nil
+	}
+	p.s.Reset()
+	expr, err := p.parseObjectLit(SILENCE)
+	if err != nil {
+		return nil, err
+	}
+	object := expr.(*ObjectLit)
+	silence.All = object.All
+	if len(object.Ref) > 0 {
+		silence.Ref = make([]xid.ID, len(object.Ref))
+		copy(silence.Ref, object.Ref)
+	}
+	silence.Pos = p.s.Offset()
+	return silence, nil
+}
+
+func (p *Parser) parseOccupancyLit() (Expr, error) {
+	if tok, lit := p.s.Next(); tok != LPAREN {
+		return nil, p.error(tok, lit, "missing (")
+	}
+	kind, lit := p.s.Next()
+	switch kind {
+	case OBJECTS, POLY, MULTI_POLY, LINE, MULTI_LINE,
+		POINT, MULTI_POINT, RECT, CIRCLE, COLLECTION, FUT_COLLECTION:
+	default:
+		return nil, p.error(kind, lit, "expected object")
+	}
+	expr, err := p.parseObjectLit(kind)
+	if err != nil {
+		return nil, err
+	}
+	object := expr.(*ObjectLit)
+	if object.All || len(object.Ref) == 0 {
+		return nil, p.error(kind, object.String(), "object ids required")
+	}
+	if tok, lit := p.s.Next(); tok != RPAREN {
+		return nil, p.error(tok, lit, "missing )")
+	}
+	return &OccupancyLit{Object: object, Pos: p.s.Offset()}, nil
+}
+
+func (p *Parser) parseTrackLit(kind Token) (Expr, error) {
+	track := &TrackLit{Kind: kind}
+	if tok := p.s.NextTok(); tok != LPAREN {
+		track.Pos = p.s.Offset()
+		p.s.Reset()
+		return track, nil
+	}
+	if kind != TRAVELLED {
+		return nil, p.error(kind, kind.String(), "window not supported")
+	}
+	// 30m, 1h30m
+	tok, val := p.s.Next()
+	if tok != INT {
+		return nil, p.error(tok, val, "missing window duration")
+	}
+	tok, unit := p.s.Next()
+	if tok != ILLEGAL {
+		return nil, p.error(tok, unit, "missing window duration unit")
+	}
+	window, err := time.ParseDuration(val + unit)
+	if err != nil {
+		return nil, p.error(tok, val+unit, err.Error())
+	}
+	if window <= 0 {
+		return nil, p.error(tok, val+unit, "expected positive window")
+	}
+	if tok, lit := p.s.Next(); tok != RPAREN {
+		return nil, p.error(tok, lit, "missing )")
+	}
+	track.Window = window
+	track.Pos = p.s.Offset()
+	return track, nil
+}
+
+func (p *Parser) parseConvoyLit() (Expr, error) {
+	expr, err := p.parseObjectLit(CONVOY)
+	if err != nil {
+		return nil, err
+	}
+	object := expr.(*ObjectLit)
+	if object.All || len(object.Ref) < 2 {
+		return nil, p.error(CONVOY, object.String(), "at least two device ids required")
+	}
+	if object.DurTyp == DURATION {
+		return nil, p.error(DURATION, object.String(), "expected :time after")
+	}
+	convoy := &ConvoyLit{
+		Ref:    make([]xid.ID, len(object.Ref)),
+		DurVal: object.DurVal,
+		Pos:    object.Pos,
+	}
+	copy(convoy.Ref, object.Ref)
+	return convoy, nil
+}
+
 func (p *Parser) parseListOrRangeLit() (Expr, error) {
 	list := &ListLit{Items: make([]Expr, 0, 2)}
 	for i := 0; i < math.MaxInt16; i++ {
@@ -644,12 +798,18 @@ func (p *Parser) parseIntOrTimeLit(val string) (Expr, error) {
 	if err != nil {
 		return nil, p.error(INT, val, err.Error())
 	}
-	tok := p.s.NextTok()
+	tok, lit := p.s.Next()
+	if tok == ILLEGAL {
+		// 30m, 1h30m
+		if dur, err := time.ParseDuration(val + lit); err == nil {
+			return &DurationLit{Kind: DURATION, Value: dur, Pos: p.s.Offset()}, nil
+		}
+	}
 	if tok != COLON {
 		p.s.Reset()
 		return &IntLit{Value: v, Pos: p.s.Offset()}, nil
 	}
-	tok, lit := p.s.Next()
+	tok, lit = p.s.Next()
 	if tok != INT {
 		return nil, p.error(tok, lit, "missing INT literal")
 	}
@@ -0,0 +1,270 @@
+package spinix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mmadfox/geojson"
+	"github.com/rs/xid"
+)
+
+type recordKind string
+
+const (
+	recordObject   recordKind = "object"
+	recordRule     recordKind = "rule"
+	recordDevice   recordKind = "device"
+	recordState    recordKind = "state"
+	recordLayer    recordKind = "layer"
+	recordIncident recordKind = "incident"
+)
+
+type recordOp string
+
+const (
+	opPut            recordOp = "put"
+	opDelete         recordOp = "del"
+	opDeleteByRule   recordOp = "delRule"
+	opDeleteByDevice recordOp = "delDevice"
+)
+
+// record is the unit of the disk log, of disk snapshots and of engine
+// snapshots, a JSON document framed by writeWalRecord.
+type record struct {
+	Kind recordKind      `json:"k"`
+	Op   recordOp        `json:"o,omitempty"`
+	Data json.RawMessage `json:"d"`
+}
+
+type objectRecord struct {
+	ID    ObjectID `json:"id"`
+	Layer LayerID  `json:"layer"`
+	Data  string   `json:"data,omitempty"`
+}
+
+type (
+	ruleScanner interface {
+		scan(fn func(*Rule))
+	}
+	objectScanner interface {
+		scan(fn func(*GeoObject))
+	}
+	deviceScanner interface {
+		scan(fn func(*Device))
+	}
+	stateScanner interface {
+		scan(fn func(*State))
+	}
+)
+
+func dumpRefs(ctx context.Context, refs reference, write func(kind recordKind, v interface{}) error) (err error) {
+	objects, ok := refs.objects.(objectScanner)
+	if !ok {
+		return fmt.Errorf("spinix/snapshot: %T does not support scanning", refs.objects)
+	}
+	rules, ok := refs.rules.(ruleScanner)
+	if !ok {
+		return fmt.Errorf("spinix/snapshot: %T does not support scanning", refs.rules)
+	}
+	devices, ok := refs.devices.(deviceScanner)
+	if !ok {
+		return fmt.Errorf("spinix/snapshot: %T does not support scanning", refs.devices)
+	}
+	states, ok := refs.states.(stateScanner)
+	if !ok {
+		return fmt.Errorf("spinix/snapshot: %T does not support scanning", refs.states)
+	}
+	if err = refs.layers.Each(ctx, func(_ context.Context, l *Layer) error {
+		return write(recordLayer, l)
+	}); err != nil {
+		return err
+	}
+	objects.scan(func(o *GeoObject) {
+		if err == nil {
+			err = write(recordObject, makeObjectRecord(o))
+		}
+	})
+	rules.scan(func(r *Rule) {
+		if err == nil {
+			err = write(recordRule, r.Snapshot())
+		}
+	})
+	devices.scan(func(d *Device) {
+		if err == nil {
+			err = write(recordDevice, d)
+		}
+	})
+	states.scan(func(s *State) {
+		if err == nil {
+			err = write(recordState, s.Snapshot())
+		}
+	})
+	if err != nil || refs.incidents == nil {
+		return err
+	}
+	return refs.incidents.Each(ctx, func(_ context.Context, i *Incident) error {
+		return write(recordIncident, i)
+	})
+}
+
+func applyRecord(ctx context.Context, refs reference, rec record) error {
+	switch rec.Kind {
+	case recordObject:
+		return applyObject(ctx, refs.objects, rec)
+	case recordRule:
+		return applyRule(ctx, refs.rules, rec)
+	case recordDevice:
+		return applyDevice(ctx, refs.devices, rec)
+	case recordState:
+		return applyState(ctx, refs.states, rec)
+	case recordLayer:
+		return applyLayer(ctx, refs.layers, rec)
+	case recordIncident:
+		return applyIncident(ctx, refs.incidents, rec)
+	default:
+		return fmt.Errorf("spinix/snapshot: unknown record kind %q", rec.Kind)
+	}
+}
+
+func applyObject(ctx context.Context, objects Objects, rec record) error {
+	var or objectRecord
+	if err := json.Unmarshal(rec.Data, &or); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		data, err := geojson.Parse(or.Data, nil)
+		if err != nil {
+			return err
+		}
+		object := NewGeoObject(or.ID, or.Layer, data)
+		if _, err := objects.Lookup(ctx, or.ID); err == nil {
+			return objects.Update(ctx, object)
+		}
+		return objects.Add(ctx, object)
+	case opDelete:
+		return ignoreNotFound(objects.Delete(ctx, or.ID))
+	}
+	return fmt.Errorf("spinix/snapshot: unknown object operation %q", rec.Op)
+}
+
+func applyRule(ctx context.Context, rules Rules, rec record) error {
+	var snap RuleSnapshot
+	if err := json.Unmarshal(rec.Data, &snap); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		rule, err := RuleFromSnapshot(snap)
+		if err != nil {
+			return err
+		}
+		if _, err := rules.Lookup(ctx, rule.ID()); err == nil {
+			return rules.Update(ctx, rule)
+		}
+		return rules.Insert(ctx, rule)
+	case opDelete:
+		id, err := xid.FromString(snap.RuleID)
+		if err != nil {
+			return err
+		}
+		return ignoreNotFound(rules.Delete(ctx, id))
+	}
+	return fmt.Errorf("spinix/snapshot: unknown rule operation %q", rec.Op)
+}
+
+func applyDevice(ctx context.Context, devices Devices, rec record) error {
+	var device Device
+	if err := json.Unmarshal(rec.Data, &device); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		_, err := devices.InsertOrReplace(ctx, &device)
+		return err
+	case opDelete:
+		return ignoreNotFound(devices.Delete(ctx, device.ID))
+	}
+	return fmt.Errorf("spinix/snapshot: unknown device operation %q", rec.Op)
+}
+
+func applyState(ctx context.Context, states States, rec record) error {
+	var snap StateSnapshot
+	if err := json.Unmarshal(rec.Data, &snap); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		state, err := states.Lookup(ctx, snap.ID)
+		if err != nil {
+			if state, err = states.Make(ctx, snap.ID); err != nil {
+				return err
+			}
+		}
+		state.FromSnapshot(snap)
+		return states.Update(ctx, state)
+	case opDelete:
+		return ignoreNotFound(states.Remove(ctx, snap.ID))
+	case opDeleteByRule:
+		return states.RemoveByRule(ctx, snap.ID.rid)
+	case opDeleteByDevice:
+		return states.RemoveByDevice(ctx, snap.ID.did)
+	}
+	return fmt.Errorf("spinix/snapshot: unknown state operation %q", rec.Op)
+}
+
+func applyLayer(ctx context.Context, layers Layers, rec record) error {
+	var layer Layer
+	if err := json.Unmarshal(rec.Data, &layer); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		return layers.InsertOrReplace(ctx, &layer)
+	case opDelete:
+		return ignoreNotFound(layers.Delete(ctx, layer.ID))
+	}
+	return fmt.Errorf("spinix/snapshot: unknown layer operation %q", rec.Op)
+}
+
+func applyIncident(ctx context.Context, incidents Incidents, rec record) error {
+	var incident Incident
+	if err := json.Unmarshal(rec.Data, &incident); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case opPut:
+		return incidents.InsertOrReplace(ctx, &incident)
+	case opDelete:
+		return ignoreNotFound(incidents.Delete(ctx, incident.ID))
+	}
+	return fmt.Errorf("spinix/snapshot: unknown incident operation %q", rec.Op)
+}
+
+func encodeRecord(kind recordKind, op recordOp, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record{Kind: kind, Op: op, Data: data})
+}
+
+func makeObjectRecord(o *GeoObject) objectRecord {
+	return objectRecord{ID: o.ID(), Layer: o.Layer(), Data: o.Data().JSON()}
+}
+
+func ignoreNotFound(err error) error {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrObjectNotFound),
+		errors.Is(err, ErrRuleNotFound),
+		errors.Is(err, ErrDeviceNotFound),
+		errors.Is(err, ErrStateNotFound),
+		errors.Is(err, ErrLayerNotFound),
+		errors.Is(err, ErrIncidentNotFound):
+		return nil
+	}
+	return err
+}
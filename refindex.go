@@ -0,0 +1,174 @@
+package spinix
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rs/xid"
+)
+
+var ErrReferenced = errors.New("spinix/engine: referenced by rules")
+
+type DeletePolicy int
+
+const (
+	DeleteReject     DeletePolicy = 1
+	DeleteCascade    DeletePolicy = 2
+	DeleteInvalidate DeletePolicy = 3
+)
+
+func (p DeletePolicy) String() string {
+	switch p {
+	case DeleteReject:
+		return "reject"
+	case DeleteCascade:
+		return "cascade"
+	case DeleteInvalidate:
+		return "invalidate"
+	default:
+		return "#?"
+	}
+}
+
+type DanglingRef struct {
+	RuleID RuleID `json:"ruleId"`
+	RefID  xid.ID `json:"refId"`
+	Kind   Token  `json:"kind"`
+}
+
+type refIndex struct {
+	byRef   map[xid.ID]map[RuleID]Token
+	byRule  map[RuleID]map[xid.ID]Token
+	invalid map[RuleID]struct{}
+	sync.RWMutex
+}
+
+func newRefIndex() *refIndex {
+	return &refIndex{
+		byRef:   make(map[xid.ID]map[RuleID]Token),
+		byRule:  make(map[RuleID]map[xid.ID]Token),
+		invalid: make(map[RuleID]struct{}),
+	}
+}
+
+// add indexes the objects and devices the rule references and the
+// layer it is scoped to.
+func (i *refIndex) add(rule *Rule) {
+	refs := rule.RefIDs()
+	if layer := rule.spec.props.layer; layer != DefaultLayer {
+		if refs == nil {
+			refs = make(map[xid.ID]Token, 1)
+		}
+		refs[layer] = LAYER
+	}
+	i.Lock()
+	defer i.Unlock()
+	ruleRefs := make(map[xid.ID]Token, len(refs))
+	for refID, tok := range refs {
+		ruleRefs[refID] = tok
+		if i.byRef[refID] == nil {
+			i.byRef[refID] = make(map[RuleID]Token)
+		}
+		i.byRef[refID][rule.ID()] = tok
+	}
+	i.byRule[rule.ID()] = ruleRefs
+}
+
+func (i *refIndex) remove(rid RuleID) {
+	i.Lock()
+	defer i.Unlock()
+	for refID := range i.byRule[rid] {
+		delete(i.byRef[refID], rid)
+		if len(i.byRef[refID]) == 0 {
+			delete(i.byRef, refID)
+		}
+	}
+	delete(i.byRule, rid)
+	delete(i.invalid, rid)
+}
+
+func (i *refIndex) rulesByRef(refID xid.ID) []RuleID {
+	i.RLock()
+	defer i.RUnlock()
+	rules := i.byRef[refID]
+	if len(rules) == 0 {
+		return nil
+	}
+	ids := make([]RuleID, 0, len(rules))
+	for rid := range rules {
+		ids = append(ids, rid)
+	}
+	xid.Sort(ids)
+	return ids
+}
+
+func (i *refIndex) refsByRule(rid RuleID) map[xid.ID]Token {
+	i.RLock()
+	defer i.RUnlock()
+	refs := make(map[xid.ID]Token, len(i.byRule[rid]))
+	for refID, tok := range i.byRule[rid] {
+		refs[refID] = tok
+	}
+	return refs
+}
+
+func (i *refIndex) ruleIDs() []RuleID {
+	i.RLock()
+	defer i.RUnlock()
+	ids := make([]RuleID, 0, len(i.byRule))
+	for rid := range i.byRule {
+		ids = append(ids, rid)
+	}
+	xid.Sort(ids)
+	return ids
+}
+
+func (i *refIndex) invalidate(rid RuleID) {
+	i.Lock()
+	defer i.Unlock()
+	if _, ok := i.byRule[rid]; !ok {
+		return
+	}
+	i.invalid[rid] = struct{}{}
+}
+
+func (i *refIndex) validate(rid RuleID) {
+	i.Lock()
+	defer i.Unlock()
+	delete(i.invalid, rid)
+}
+
+// invalidByRef returns the invalidated rules that reference refID.
+func (i *refIndex) invalidByRef(refID xid.ID) []RuleID {
+	i.RLock()
+	defer i.RUnlock()
+	if len(i.invalid) == 0 {
+		return nil
+	}
+	var ids []RuleID
+	for rid := range i.byRef[refID] {
+		if _, ok := i.invalid[rid]; ok {
+			ids = append(ids, rid)
+		}
+	}
+	xid.Sort(ids)
+	return ids
+}
+
+func (i *refIndex) isInvalid(rid RuleID) bool {
+	i.RLock()
+	defer i.RUnlock()
+	_, ok := i.invalid[rid]
+	return ok
+}
+
+func (i *refIndex) invalidRules() []RuleID {
+	i.RLock()
+	defer i.RUnlock()
+	ids := make([]RuleID, 0, len(i.invalid))
+	for rid := range i.invalid {
+		ids = append(ids, rid)
+	}
+	xid.Sort(ids)
+	return ids
+}
@@ -17,6 +17,7 @@ var ErrRuleNotFound = errors.New("spinix/rule: rule not found")
 type Rules interface {
 	Walk(ctx context.Context, lat float64, lon float64, fn RuleIterFunc) error
 	Insert(ctx context.Context, r *Rule) error
+	Update(ctx context.Context, r *Rule) error
 	Delete(ctx context.Context, id RuleID) error
 	Lookup(ctx context.Context, id RuleID) (*Rule, error)
 }
@@ -27,11 +28,14 @@ type RuleIterFunc func(ctx context.Context, rule *Rule, err error) error
 
 type Rule struct {
 	id         RuleID
+	source     string
 	specStr    string
 	spec       *spec
 	bbox       geometry.Rect
 	regions    []RegionID
 	regionSize RegionSize
+	autoCenter bool
+	initRadius float64
 }
 
 func (r *Rule) MarshalJSON() ([]byte, error) {
@@ -64,14 +68,15 @@ func (r *Rule) UnmarshalJSON(data []byte) (err error) {
 		regions[i] = rid
 	}
 	normalizeDistance(ruleSpec.props.radius, size)
-	if ruleSpec.props.center.X == 0 && ruleSpec.props.center.Y == 0 {
-		return fmt.Errorf("spinix/rule: center of the rule is not specified")
+	if err := ruleSpec.validate(); err != nil {
+		return err
 	}
 	id, err := xid.FromString(snap.RuleID)
 	if err != nil {
 		return err
 	}
 	r.id = id
+	r.source = snap.Spec
 	r.regions = regions
 	r.regionSize = size
 	r.specStr = expr.String()
@@ -83,6 +88,12 @@ func (r *Rule) UnmarshalJSON(data []byte) (err error) {
 }
 
 func (r *Rule) calc() error {
+	if r.spec.isRegionless() {
+		r.regionSize = RegionSizeFromMeters(r.spec.props.radius)
+		r.regions = nil
+		r.bbox = geometry.Rect{}
+		return r.regionSize.Validate()
+	}
 	circle, bbox := makeCircle(
 		r.spec.props.center.X,
 		r.spec.props.center.Y,
@@ -98,6 +109,23 @@ func (r *Rule) calc() error {
 	return nil
 }
 
+func (r *Rule) clone() *Rule {
+	props := *r.spec.props
+	ruleSpec := *r.spec
+	ruleSpec.props = &props
+	return &Rule{
+		id:         r.id,
+		source:     r.source,
+		specStr:    r.specStr,
+		spec:       &ruleSpec,
+		bbox:       r.bbox,
+		regions:    r.RegionIDs(),
+		regionSize: r.regionSize,
+		autoCenter: r.autoCenter,
+		initRadius: r.initRadius,
+	}
+}
+
 func (r *Rule) RegionSize() RegionSize {
 	return r.regionSize
 }
@@ -161,7 +189,7 @@ func RuleFromSpec(id xid.ID, regions []RegionID, size RegionSize, spec string) (
 	if err := ruleSpec.validate(); err != nil {
 		return nil, err
 	}
-	rule := &Rule{id: id}
+	rule := &Rule{id: id, source: spec}
 	rule.regions = regions
 	rule.regionSize = size
 	rule.specStr = expr.String()
@@ -189,6 +217,7 @@ func NewRule(spec string) (*Rule, error) {
 	}
 	rule := &Rule{
 		id:      xid.New(),
+		source:  spec,
 		spec:    ruleSpec,
 		specStr: expr.String(),
 	}
@@ -201,6 +230,13 @@ func NewRule(spec string) (*Rule, error) {
 type RuleSnapshot struct {
 	RuleID     string   `json:"ID"`
 	Spec       string   `json:"spec"`
+	Source     string   `json:"source,omitempty"`
+	Lat        float64  `json:"lat,omitempty"`
+	Lon        float64  `json:"lon,omitempty"`
+	Radius     float64  `json:"radius,omitempty"`
+	AutoCenter bool     `json:"autoCenter,omitempty"`
+	InitRadius float64  `json:"initRadius,omitempty"`
+	Webhook    string   `json:"webhook,omitempty"`
 	RegionIDs  []string `json:"RegionIDs"`
 	RegionSize int      `json:"regionSize"`
 }
@@ -209,6 +245,13 @@ func (r *Rule) Snapshot() RuleSnapshot {
 	snapshot := RuleSnapshot{
 		RuleID:     r.id.String(),
 		Spec:       r.specStr,
+		Source:     r.source,
+		Lat:        r.spec.props.center.X,
+		Lon:        r.spec.props.center.Y,
+		Radius:     r.spec.props.radius,
+		AutoCenter: r.autoCenter,
+		InitRadius: r.initRadius,
+		Webhook:    r.spec.props.webhook,
 		RegionIDs:  make([]string, len(r.regions)),
 		RegionSize: r.regionSize.Value(),
 	}
@@ -218,6 +261,34 @@ func (r *Rule) Snapshot() RuleSnapshot {
 	return snapshot
 }
 
+// RuleFromSnapshot rebuilds a rule from its source specification and
+// the coordinates it was assigned when it was added.
+func RuleFromSnapshot(snap RuleSnapshot) (*Rule, error) {
+	spec := snap.Source
+	if len(spec) == 0 {
+		spec = snap.Spec
+	}
+	id, err := xid.FromString(snap.RuleID)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := NewRule(spec)
+	if err != nil {
+		return nil, err
+	}
+	rule.id = id
+	rule.spec.props.center = geometry.Point{X: snap.Lat, Y: snap.Lon}
+	if snap.Radius > 0 {
+		rule.spec.props.radius = snap.Radius
+	}
+	rule.autoCenter = snap.AutoCenter
+	rule.initRadius = snap.InitRadius
+	if err := rule.calc(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
 func NewMemoryRules() Rules {
 	return &rules{
 		indexByRules:      newRuleIndex(),
@@ -227,21 +298,25 @@ func NewMemoryRules() Rules {
 }
 
 func (r *rules) Walk(ctx context.Context, lat float64, lon float64, fn RuleIterFunc) error {
-	regionID := RegionFromLatLon(lat, lon, SmallRegionSize)
+	// collect the matching rules under the lock and evaluate them after
+	// releasing it, so detection does not block rule updates
+	var found []*Rule
+	collect := func(_ context.Context, rule *Rule, _ error) error {
+		found = append(found, rule)
+		return nil
+	}
 	r.RLock()
-	region, ok := r.smallRegionsCells[regionID]
-	r.RUnlock()
-	if ok {
-		if err := region.walk(ctx, lat, lon, fn); err != nil {
-			return err
-		}
+	regionID := RegionFromLatLon(lat, lon, SmallRegionSize)
+	if region, ok := r.smallRegionsCells[regionID]; ok {
+		_ = region.walk(ctx, lat, lon, collect)
 	}
 	regionID = RegionFromLatLon(lat, lon, LargeRegionSize)
-	r.RLock()
-	region, ok = r.largeRegionsCells[regionID]
+	if region, ok := r.largeRegionsCells[regionID]; ok {
+		_ = region.walk(ctx, lat, lon, collect)
+	}
 	r.RUnlock()
-	if ok {
-		if err := region.walk(ctx, lat, lon, fn); err != nil {
+	for _, rule := range found {
+		if err := fn(ctx, rule, nil); err != nil {
 			return err
 		}
 	}
@@ -252,77 +327,99 @@ func (r *rules) Insert(_ context.Context, rule *Rule) error {
 	if rule == nil {
 		return fmt.Errorf("spinix/rule: not specified")
 	}
-
 	if err := rule.spec.validate(); err != nil {
 		return err
 	}
+	r.Lock()
+	defer r.Unlock()
+	if err := r.indexByRules.set(rule); err != nil {
+		return err
+	}
+	r.insertCells(rule)
+	return nil
+}
 
-	var region *regionCell
-	var found bool
-
-	for _, regionID := range rule.regions {
-		switch rule.regionSize {
-		case SmallRegionSize:
-			r.RLock()
-			region, found = r.smallRegionsCells[regionID]
-			r.RUnlock()
-			if !found {
-				region = newRegionCell(regionID, rule.regionSize)
-				found = true
-				r.Lock()
-				r.smallRegionsCells[regionID] = region
-				r.Unlock()
-			}
-		case LargeRegionSize:
-			r.RLock()
-			region, found = r.largeRegionsCells[regionID]
-			r.RUnlock()
-			if !found {
-				region = newRegionCell(regionID, rule.regionSize)
-				found = true
-				r.Lock()
-				r.largeRegionsCells[regionID] = region
-				r.Unlock()
-			}
-		}
-		if region != nil && found {
-			region.insert(rule)
-		}
-		region = nil
+func (r *rules) Update(_ context.Context, rule *Rule) error {
+	if rule == nil {
+		return fmt.Errorf("spinix/rule: not specified")
+	}
+	if err := rule.spec.validate(); err != nil {
+		return err
 	}
-	return r.indexByRules.set(rule)
+	r.Lock()
+	defer r.Unlock()
+	prev, err := r.indexByRules.get(rule.ID())
+	if err != nil {
+		return err
+	}
+	r.deleteCells(prev)
+	r.insertCells(rule)
+	r.indexByRules.replace(rule)
+	return nil
 }
 
 func (r *rules) Delete(_ context.Context, id RuleID) error {
+	r.Lock()
+	defer r.Unlock()
 	rule, err := r.indexByRules.get(id)
 	if err != nil {
 		return err
 	}
-	var region *regionCell
-	var found bool
+	r.deleteCells(rule)
+	return r.indexByRules.delete(id)
+}
+
+func (r *rules) cells(size RegionSize) map[RegionID]*regionCell {
+	switch size {
+	case SmallRegionSize:
+		return r.smallRegionsCells
+	case LargeRegionSize:
+		return r.largeRegionsCells
+	default:
+		return nil
+	}
+}
+
+func (r *rules) insertCells(rule *Rule) {
+	cells := r.cells(rule.regionSize)
+	if cells == nil {
+		return
+	}
 	for _, regionID := range rule.regions {
-		switch rule.regionSize {
-		case SmallRegionSize:
-			r.RLock()
-			region, found = r.smallRegionsCells[regionID]
-			r.RUnlock()
-		case LargeRegionSize:
-			r.RLock()
-			region, found = r.largeRegionsCells[regionID]
-			r.RUnlock()
+		region, found := cells[regionID]
+		if !found {
+			region = newRegionCell(regionID, rule.regionSize)
+			cells[regionID] = region
 		}
-		if region == nil || !found {
+		region.insert(rule)
+	}
+}
+
+func (r *rules) deleteCells(rule *Rule) {
+	cells := r.cells(rule.regionSize)
+	if cells == nil {
+		return
+	}
+	for _, regionID := range rule.regions {
+		region, found := cells[regionID]
+		if !found {
 			continue
 		}
 		region.delete(rule)
 		if region.isEmpty() {
-			r.Lock()
-			delete(r.smallRegionsCells, regionID)
-			r.Unlock()
+			delete(cells, regionID)
 		}
-		region = nil
 	}
-	return r.indexByRules.delete(id)
+}
+
+func (r *rules) scan(fn func(*Rule)) {
+	for _, bucket := range r.indexByRules {
+		bucket.RLock()
+		for _, rule := range bucket.index {
+			fn(rule)
+		}
+		bucket.RUnlock()
+	}
 }
 
 func (r *rules) Lookup(_ context.Context, id RuleID) (*Rule, error) {
@@ -361,6 +458,13 @@ func (i ruleIndex) set(rule *Rule) error {
 	return nil
 }
 
+func (i ruleIndex) replace(rule *Rule) {
+	bucket := i.bucket(rule.ID())
+	bucket.Lock()
+	defer bucket.Unlock()
+	bucket.index[rule.ID()] = rule
+}
+
 func (i ruleIndex) delete(id RuleID) error {
 	bucket := i.bucket(id)
 	bucket.Lock()
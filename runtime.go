@@ -8,6 +8,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/xid"
@@ -30,10 +31,14 @@ type evaluater interface {
 }
 
 type reference struct {
-	rules   Rules
-	objects Objects
-	devices Devices
-	states  States
+	rules     Rules
+	objects   Objects
+	devices   Devices
+	states    States
+	layers    Layers
+	history   History
+	incidents Incidents
+	occupancy *occupancy
 }
 
 type Match struct {
@@ -51,10 +56,12 @@ type Decl struct {
 
 func defaultRefs() reference {
 	return reference{
-		devices: NewMemoryDevices(),
-		objects: NewMemoryObjects(),
-		rules:   NewMemoryRules(),
-		states:  NewMemoryState(),
+		devices:   NewMemoryDevices(),
+		objects:   NewMemoryObjects(),
+		rules:     NewMemoryRules(),
+		states:    NewMemoryState(),
+		layers:    NewMemoryLayers(),
+		incidents: NewMemoryIncidents(),
 	}
 }
 
@@ -66,8 +73,10 @@ type specProps struct {
 	delay         time.Duration
 	center        geometry.Point
 	expire        time.Duration
+	maxAge        time.Duration
 	radius        float64
 	layer         LayerID
+	webhook       string
 }
 
 type spec struct {
@@ -75,7 +84,11 @@ type spec struct {
 	ops        []Token
 	pos        Pos
 	isStateful bool
+	isAbsence  bool
 	props      *specProps
+	// group serialises the evaluations of convoy rules, each of them
+	// changes the states of all members
+	group *sync.Mutex
 }
 
 func (s *spec) normalizeRadius(size RegionSize) {
@@ -86,12 +99,23 @@ func (s *spec) normalizeRadius(size RegionSize) {
 }
 
 func (s *spec) validate() error {
-	if s.props.center.X == 0 && s.props.center.Y == 0 {
+	if !s.hasArea() && !s.isAbsence && !s.isMemberBound() {
 		return fmt.Errorf("spinix/rule: coordinates are not specified")
 	}
 	return nil
 }
 
+func (s *spec) hasArea() bool {
+	return s.props.center.X != 0 || s.props.center.Y != 0
+}
+
+// isRegionless reports whether the rule is evaluated without an area,
+// silence rules by the timer and convoy rules on the member reports.
+// Such rules need no coordinates and are not indexed by region.
+func (s *spec) isRegionless() bool {
+	return !s.hasArea() && (s.isAbsence || s.isMemberBound())
+}
+
 func specFromString(s string) (*spec, error) {
 	expr, err := ParseSpec(s)
 	if err != nil {
@@ -108,18 +132,16 @@ func (s *spec) changeState(state *State) {
 	}
 }
 
-func (s *spec) checkTrigger(state *State, device *Device) bool {
+func (s *spec) checkTrigger(state *State) bool {
 	switch s.props.repeat {
 	case RepeatEvery:
 		if state.lastSeenTime == 0 {
 			return true
 		}
-		currTime := mapper{device: device}.dateTime()
-		dur := currTime.Unix() - state.LastResetTime()
+		dur := state.now - state.LastResetTime()
 		return dur > int64(s.props.delay.Seconds())
 	case RepeatTimes:
-		currTime := mapper{device: device}.dateTime()
-		dur := currTime.Unix() - state.LastSeenTime()
+		dur := state.now - state.LastSeenTime()
 		if dur < int64(s.props.interval.Seconds()) {
 			return false
 		}
@@ -130,46 +152,104 @@ func (s *spec) checkTrigger(state *State, device *Device) bool {
 	return true
 }
 
-func (s *spec) evaluate(ctx context.Context, rid RuleID, d *Device, r reference) (matches []Match, ok bool, err error) {
-	if d == nil || len(s.nodes) == 0 || s.props.layer != d.Layer {
+type evalEnv struct {
+	now      int64
+	readOnly bool
+	trace    *ruleTrace
+	held     *bool
+}
+
+func (s *spec) lookupState(ctx context.Context, sid StateID, r reference) (*State, error) {
+	state, err := r.states.Lookup(ctx, sid)
+	if err != nil {
+		if !errors.Is(err, ErrStateNotFound) {
+			return nil, err
+		}
+		return r.states.Make(ctx, sid)
+	}
+	return state, nil
+}
+
+func (s *spec) updateState(ctx context.Context, state *State, env evalEnv, r reference) error {
+	s.changeState(state)
+	if env.readOnly {
+		return nil
+	}
+	return r.states.Update(ctx, state)
+}
+
+func (s *spec) evaluate(ctx context.Context, rid RuleID, d *Device, env evalEnv, r reference) (matches []Match, ok bool, err error) {
+	if d == nil || len(s.nodes) == 0 {
+		return
+	}
+	if s.props.layer != d.Layer {
+		env.trace.stop("device layer does not match the rule layer")
 		return
 	}
+	if s.group != nil {
+		s.group.Lock()
+		defer s.group.Unlock()
+	}
+	if env.readOnly {
+		// neither the state of the device nor the states of other
+		// group members are changed
+		r.states = isolatedStates{States: r.states}
+	}
 
 	var currState *State
 	if s.isStateful {
 		sid := StateID{did: d.ID, rid: rid}
-		currState, err = r.states.Lookup(ctx, sid)
+		currState, err = s.lookupState(ctx, sid, r)
 		if err != nil {
-			if errors.Is(err, ErrStateNotFound) {
-				if currState, err = r.states.Make(ctx, sid); err != nil {
-					return
-				}
-				err = nil
-			} else {
-				return
-			}
+			return
 		}
 
-		currState.SetTime(time.Now().Unix())
+		currState.SetTime(env.now)
 
-		if currState.NeedReset(s.props.resetInterval) {
+		needReset := currState.NeedReset(s.props.resetInterval)
+		if needReset {
 			currState.Reset()
 			currState.UpdateLastResetTime()
 		}
 
-		if ok := s.checkTrigger(currState, d); !ok {
-			return nil, false, nil
+		ok := s.checkTrigger(currState)
+		env.trace.state(needReset, ok)
+		if !ok {
+			env.trace.stop("trigger condition is not satisfied")
+			if env.held != nil {
+				// the trigger holds back the event, not the condition
+				*env.held, err = s.holds(ctx, d, currState, env, r)
+			}
+			return nil, false, err
 		}
 	}
+	return s.evaluateNodes(ctx, d, currState, env, r)
+}
+
+// holds evaluates the nodes against copies of the states, the stored
+// states stay as they are.
+func (s *spec) holds(ctx context.Context, d *Device, state *State, env evalEnv, r reference) (bool, error) {
+	isolated := NewState(state.ID())
+	isolated.FromSnapshot(state.Snapshot())
+	env.readOnly = true
+	env.trace = nil
+	env.held = nil
+	r.states = isolatedStates{States: r.states}
+	_, ok, err := s.evaluateNodes(ctx, d, isolated, env, r)
+	return ok, err
+}
 
+func (s *spec) evaluateNodes(ctx context.Context, d *Device, currState *State, env evalEnv, r reference) (matches []Match, ok bool, err error) {
 	if len(s.nodes) == 1 {
+		env.trace.begin(0)
 		match, err := s.nodes[0].evaluate(ctx, d, currState, r, s.props)
 		if err != nil {
 			return nil, false, err
 		}
-		if s.isStateful && currState != nil {
-			s.changeState(currState)
-			if err = r.states.Update(ctx, currState); err != nil {
+		env.trace.end(0, match)
+		// absence rules are polled, so only a match counts as a hit
+		if s.isStateful && currState != nil && (match.Ok || !s.isAbsence) {
+			if err = s.updateState(ctx, currState, env, r); err != nil {
 				return nil, false, err
 			}
 		}
@@ -192,6 +272,7 @@ func (s *spec) evaluate(ctx context.Context, rid RuleID, d *Device, r reference)
 
 		if index > 0 {
 			if !ok && op == AND {
+				env.trace.skip(index, "left operand of AND is false")
 				if index < len(s.ops) {
 					op = s.ops[index]
 				}
@@ -200,10 +281,12 @@ func (s *spec) evaluate(ctx context.Context, rid RuleID, d *Device, r reference)
 			}
 		}
 
+		env.trace.begin(index)
 		right, err = s.nodes[index].evaluate(ctx, d, currState, r, s.props)
 		if err != nil {
 			return nil, false, err
 		}
+		env.trace.end(index, right)
 		if index < len(s.ops) {
 			op = s.ops[index]
 		}
@@ -229,13 +312,38 @@ func (s *spec) evaluate(ctx context.Context, rid RuleID, d *Device, r reference)
 		}
 		index++
 	}
-	if s.isStateful && currState != nil {
-		s.changeState(currState)
-		err = r.states.Update(ctx, currState)
+	if s.isStateful && currState != nil && (ok || !s.isAbsence) {
+		err = s.updateState(ctx, currState, env, r)
 	}
 	return
 }
 
+// isolatedStates hands out copies of the states and drops the changes.
+type isolatedStates struct {
+	States
+}
+
+func (s isolatedStates) Lookup(ctx context.Context, id StateID) (*State, error) {
+	state, err := s.States.Lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	isolated := NewState(id)
+	isolated.FromSnapshot(state.Snapshot())
+	return isolated, nil
+}
+
+func (s isolatedStates) Make(_ context.Context, id StateID) (*State, error) {
+	if err := id.validate(); err != nil {
+		return nil, err
+	}
+	return NewState(id), nil
+}
+
+func (s isolatedStates) Update(context.Context, *State) error {
+	return nil
+}
+
 func walkExpr(
 	expr Expr,
 	exprFunc func(a, b Expr, op Token) error,
@@ -272,6 +380,8 @@ func walkExpr(
 
 func isStateful(e Expr) bool {
 	switch expr := e.(type) {
+	case *ConvoyLit:
+		return true
 	case *ObjectLit:
 		switch expr.DurTyp {
 		case DURATION, AFTER:
@@ -313,6 +423,18 @@ func setupProps(sp *specProps, expr *PropExpr) {
 					continue
 				}
 				sp.expire = durLit.Value
+			case MAXAGE:
+				durLit, ok := prop.Expr.(*DurationLit)
+				if !ok {
+					continue
+				}
+				sp.maxAge = durLit.Value
+			case WEBHOOK:
+				strLit, ok := prop.Expr.(*StringLit)
+				if !ok {
+					continue
+				}
+				sp.webhook = strLit.Value
 			}
 		case *ResetLit:
 			sp.resetInterval = prop.After
@@ -323,9 +445,6 @@ func setupProps(sp *specProps, expr *PropExpr) {
 			sp.interval = prop.Interval
 		}
 	}
-	if sp.resetInterval == 0 {
-		sp.resetInterval = 24 * time.Hour
-	}
 }
 
 func exprToSpec(e Expr) (*spec, error) {
@@ -341,6 +460,10 @@ func exprToSpec(e Expr) (*spec, error) {
 		setupProps(s.props, propExpr)
 		e = propExpr.Expr
 	}
+	// rules without properties are stateful through their conditions too
+	if s.props.resetInterval == 0 {
+		s.props.resetInterval = 24 * time.Hour
+	}
 
 	_, err := walkExpr(e,
 		func(a, b Expr, op Token) error {
@@ -370,6 +493,15 @@ func exprToSpec(e Expr) (*spec, error) {
 	if len(s.nodes)-1 != len(s.ops) {
 		return nil, errInvalidSpec
 	}
+	if err := s.setupAbsence(); err != nil {
+		return nil, err
+	}
+	for _, node := range s.nodes {
+		if _, ok := node.(convoyOp); ok {
+			s.group = new(sync.Mutex)
+			break
+		}
+	}
 	return s, nil
 }
 
@@ -861,6 +993,26 @@ func e2equal(left, right Expr, op Token) (evaluater, error) {
 				op:    op,
 			}, nil
 		}
+	// silence -> duration
+	case *SilenceLit:
+		switch rhs := right.(type) {
+		case *DurationLit:
+			return newSilenceOp(lhs, rhs, op), nil
+		}
+	// convoy -> meters
+	case *ConvoyLit:
+		return e2convoy(lhs, right, op)
+	// occupancy -> int
+	case *OccupancyLit:
+		switch rhs := right.(type) {
+		case *IntLit:
+			return occupancyOp{
+				object: lhs.Object,
+				value:  rhs.Value,
+				op:     op,
+				pos:    lhs.Pos,
+			}, nil
+		}
 	// object -> device
 	case *ObjectLit:
 		switch rhs := right.(type) {
@@ -942,6 +1094,8 @@ func e2equal(left, right Expr, op Token) (evaluater, error) {
 			}
 			return equalIntOp{keyword: rhs.Kind, value: lhs.Value, pos: rhs.Pos, op: op}, nil
 		}
+	case *TrackLit:
+		return e2track(lhs, right, op)
 	case *IdentLit:
 		switch rhs := right.(type) {
 		// ident -> int
@@ -1851,7 +2005,7 @@ func (n equalDevicesOp) evaluate(ctx context.Context, d *Device, _ *State, ref r
 		deviceID := n.right.Ref[i]
 		other, err := ref.devices.Lookup(ctx, deviceID)
 		if err != nil {
-			if errors.Is(err, ErrObjectNotFound) {
+			if errors.Is(err, ErrDeviceNotFound) {
 				continue
 			}
 			return match, err
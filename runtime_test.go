@@ -3,6 +3,7 @@ package spinix
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/rs/xid"
 )
@@ -211,7 +212,7 @@ func assertRuntimeTestCase(t *testing.T, cases []rTestCase) {
 				t.Fatalf("specFromString(%s) => got nil, expected err", specstr)
 			}
 			ruleID := xid.New()
-			matches, _, err := spec.evaluate(context.TODO(), ruleID, tc.target, refs)
+			matches, _, err := spec.evaluate(context.TODO(), ruleID, tc.target, evalEnv{now: time.Now().Unix()}, refs)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -90,6 +90,10 @@ func (s *Scanner) Next() (tok Token, lit string) {
 			tok = BBOX
 		case "layer":
 			tok = LAYER
+		case "webhook":
+			tok = WEBHOOK
+		case "maxage":
+			tok = MAXAGE
 		default:
 			s.Reset()
 		}
@@ -175,6 +179,16 @@ func (s *Scanner) Next() (tok Token, lit string) {
 				tok = OWNER
 			case "imei":
 				tok = IMEI
+			case "silence":
+				tok = SILENCE
+			case "travelled":
+				tok = TRAVELLED
+			case "stopped":
+				tok = STOPPED
+			case "occupancy":
+				tok = OCCUPANCY
+			case "convoy":
+				tok = CONVOY
 			case "device":
 				tok = DEVICE
 			case "range":
@@ -0,0 +1,57 @@
+package spinix
+
+import (
+	"fmt"
+
+	"github.com/mmadfox/geojson"
+)
+
+type SearchPredicate int
+
+const (
+	SearchIntersects SearchPredicate = 1
+	SearchWithin     SearchPredicate = 2
+	SearchContains   SearchPredicate = 3
+)
+
+func (p SearchPredicate) String() string {
+	switch p {
+	case SearchIntersects:
+		return "intersects"
+	case SearchWithin:
+		return "within"
+	case SearchContains:
+		return "contains"
+	default:
+		return "#?"
+	}
+}
+
+func (p SearchPredicate) Validate() error {
+	switch p {
+	case SearchIntersects, SearchWithin, SearchContains:
+		return nil
+	default:
+		return fmt.Errorf("spinix/search: unknown predicate %d", p)
+	}
+}
+
+func (p SearchPredicate) match(data, query geojson.Object) bool {
+	switch p {
+	case SearchIntersects:
+		return data.Intersects(query)
+	case SearchWithin:
+		return data.Within(query)
+	case SearchContains:
+		return data.Contains(query)
+	default:
+		return false
+	}
+}
+
+func validateSearch(query geojson.Object, p SearchPredicate) error {
+	if query == nil || query.Empty() {
+		return fmt.Errorf("spinix/search: geometry not specified")
+	}
+	return p.Validate()
+}
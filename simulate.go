@@ -0,0 +1,91 @@
+package spinix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mmadfox/geojson"
+)
+
+// Simulate replays the track against the rule in an isolated engine.
+// The simulated engine shares objects and layers with e, all other
+// stores are fresh, so the simulation leaves no trace in e.
+func (e *Engine) Simulate(ctx context.Context, spec string, track []*Device) ([]Event, error) {
+	sim := New(
+		WithObjectsStorage(e.refs.objects),
+		WithLayersStorage(e.refs.layers),
+		WithRulesStorage(NewMemoryRules()),
+		WithDevicesStorage(NewMemoryDevices()),
+		WithStatesStorage(NewMemoryState()),
+		WithHistory(NewMemoryHistory()),
+		WithOccupancy(),
+		WithDeletePolicy(e.deletePolicy),
+		WithDetectWorkers(e.workers),
+		WithStreamBuffer(e.streamBuffer),
+		WithClock(e.clock),
+		WithTimeMode(EventTime),
+		WithLatePolicy(e.latePolicy),
+	)
+	defer sim.Close()
+	if _, err := sim.AddRule(ctx, spec); err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, report := range track {
+		if report == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		device := *report
+		device.ResetRegion()
+		res, _, err := sim.Detect(ctx, &device)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, res...)
+	}
+	return events, nil
+}
+
+// TrackFromLineString converts a line into device reports.
+// The timestamps are taken from the times argument or,
+// when it is empty, from the fourth coordinate value [lat, lon, alt, unixtime].
+func TrackFromLineString(id DeviceID, line *geojson.LineString, times []int64) ([]*Device, error) {
+	if line == nil || line.Empty() {
+		return nil, fmt.Errorf("spinix/simulate: track is empty")
+	}
+	var data struct {
+		Coordinates [][]float64 `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(line.JSON()), &data); err != nil {
+		return nil, err
+	}
+	if len(times) > 0 && len(times) != len(data.Coordinates) {
+		return nil, fmt.Errorf("spinix/simulate: got %d timestamps, expected %d",
+			len(times), len(data.Coordinates))
+	}
+	track := make([]*Device, len(data.Coordinates))
+	for i, coords := range data.Coordinates {
+		device := &Device{
+			ID:        id,
+			Latitude:  coords[0],
+			Longitude: coords[1],
+		}
+		if len(coords) > 2 {
+			device.Altitude = coords[2]
+		}
+		switch {
+		case len(times) > 0:
+			device.DateTime = times[i]
+		case len(coords) > 3:
+			device.DateTime = int64(coords[3])
+		default:
+			return nil, fmt.Errorf("spinix/simulate: timestamp of point %d not specified", i)
+		}
+		track[i] = device
+	}
+	return track, nil
+}
@@ -0,0 +1,51 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mmadfox/geojson"
+)
+
+func TestEngineSimulate(t *testing.T) {
+	ctx := context.Background()
+	engine := New()
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	object, err := geojson.Parse(`{"type":"LineString","coordinates":[
+		[42.9236075, -72.2792333, 0, 1590998400],
+		[42.9236075, -72.2792333, 0, 1591000200],
+		[42.9236075, -72.2792333, 0, 1591006200]
+	]}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := TrackFromLineString(did("c5vj26evvhfjvfseauk0"), object.(*geojson.LineString), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := track[1].DateTime, int64(1591000200); have != want {
+		t.Fatalf("have %d, want %d track dateTime", have, want)
+	}
+	events, err := engine.Simulate(ctx,
+		`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once :reset after 1h }`, track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(events), 2; have != want {
+		t.Fatalf("have %d, want %d events", have, want)
+	}
+	if have, want := events[1].DateTime, track[2].DateTime; have != want {
+		t.Fatalf("have %d, want %d event dateTime", have, want)
+	}
+	if _, err := engine.Devices().Lookup(ctx, track[0].ID); err == nil {
+		t.Fatalf("have device, want isolated simulation")
+	}
+	_, err = engine.Simulate(ctx,
+		`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :layer c5vj26evvhfjvfseaumg }`, track)
+	if !errors.Is(err, ErrLayerNotFound) {
+		t.Fatalf("have %v, want ErrLayerNotFound", err)
+	}
+}
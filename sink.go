@@ -0,0 +1,384 @@
+package spinix
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrSinkClosed = errors.New("spinix/sink: closed")
+
+// EventSink delivers events to an external system. Send must be safe
+// to call again with the same batch, delivery is at least once. A sink
+// that delivered part of a batch returns a SendError with the rest.
+// Send must return once its context is done.
+type EventSink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+type SinkErrorFunc func(events []Event, err error)
+
+// SendError reports the events of a batch that were not delivered.
+// The dispatcher retries only these events.
+type SendError struct {
+	Events []Event
+	Err    error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("spinix/sink: %d events not delivered: %v", len(e.Events), e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+type SinkOption func(*sinkDispatcher)
+
+func WithSinkBatchSize(n int) SinkOption {
+	return func(d *sinkDispatcher) {
+		if n > 0 {
+			d.batchSize = n
+		}
+	}
+}
+
+func WithSinkFlushInterval(interval time.Duration) SinkOption {
+	return func(d *sinkDispatcher) {
+		if interval > 0 {
+			d.flushInterval = interval
+		}
+	}
+}
+
+func WithSinkBuffer(size int) SinkOption {
+	return func(d *sinkDispatcher) {
+		if size >= 0 {
+			d.buffer = size
+		}
+	}
+}
+
+// WithSinkRetry sets the number of retries and the backoff bounds.
+// Zero retries means retry until the engine is closed.
+func WithSinkRetry(retries int, minBackoff, maxBackoff time.Duration) SinkOption {
+	return func(d *sinkDispatcher) {
+		d.retries = retries
+		d.minBackoff = minBackoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithSinkCloseTimeout sets how long Close waits for the last batches
+// before it cancels the context of the sink.
+func WithSinkCloseTimeout(timeout time.Duration) SinkOption {
+	return func(d *sinkDispatcher) {
+		if timeout > 0 {
+			d.closeTimeout = timeout
+		}
+	}
+}
+
+// WithSinkError sets the function called with a batch that could
+// not be delivered after all retries.
+func WithSinkError(fn SinkErrorFunc) SinkOption {
+	return func(d *sinkDispatcher) {
+		d.onError = fn
+	}
+}
+
+// WithEventSink registers a sink that receives every event produced by
+// the engine. Events are batched and delivered in the background.
+func WithEventSink(sink EventSink, opts ...SinkOption) Option {
+	return func(e *Engine) {
+		d := &sinkDispatcher{
+			sink:          sink,
+			batchSize:     100,
+			flushInterval: time.Second,
+			buffer:        1024,
+			retries:       5,
+			minBackoff:    100 * time.Millisecond,
+			maxBackoff:    30 * time.Second,
+			closeTimeout:  5 * time.Second,
+			closing:       make(chan struct{}),
+			done:          make(chan struct{}),
+		}
+		d.ctx, d.cancel = context.WithCancel(context.Background())
+		for _, f := range opts {
+			f(d)
+		}
+		e.sinks = append(e.sinks, d)
+	}
+}
+
+// Close flushes pending events to the sinks and stops delivery. A sink
+// still busy after its close timeout sees a cancelled context.
+func (e *Engine) Close() error {
+	e.closeOnce.Do(func() {
+		for _, d := range e.sinks {
+			d.close()
+		}
+	})
+	return nil
+}
+
+func (e *Engine) startSinks() {
+	for _, d := range e.sinks {
+		d.start()
+	}
+}
+
+// publish hands the events to every sink. Events a sink does not accept
+// go to its error function, the first such error is returned.
+func (e *Engine) publish(ctx context.Context, events []Event) (err error) {
+	if len(events) == 0 {
+		return nil
+	}
+	for _, d := range e.sinks {
+		if serr := d.enqueue(ctx, events); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+type sinkDispatcher struct {
+	sink          EventSink
+	batchSize     int
+	flushInterval time.Duration
+	buffer        int
+	retries       int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	closeTimeout  time.Duration
+	onError       SinkErrorFunc
+
+	mu      sync.RWMutex
+	closed  bool
+	pending sync.WaitGroup
+	queue   chan Event
+	closing chan struct{}
+	done    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func (d *sinkDispatcher) start() {
+	d.queue = make(chan Event, d.buffer)
+	go d.loop()
+}
+
+// enqueue does not hold the lock while it waits for room in the queue,
+// close waits for pending calls instead.
+func (d *sinkDispatcher) enqueue(ctx context.Context, events []Event) error {
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		d.fail(events, ErrSinkClosed)
+		return ErrSinkClosed
+	}
+	d.pending.Add(1)
+	d.mu.RUnlock()
+	defer d.pending.Done()
+	for i, event := range events {
+		select {
+		case <-ctx.Done():
+			d.fail(events[i:], ctx.Err())
+			return ctx.Err()
+		case <-d.closing:
+			d.fail(events[i:], ErrSinkClosed)
+			return ErrSinkClosed
+		case d.queue <- event:
+		}
+	}
+	return nil
+}
+
+func (d *sinkDispatcher) close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.closing)
+	d.mu.Unlock()
+	d.pending.Wait()
+	close(d.queue)
+	defer d.cancel()
+	timer := time.NewTimer(d.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-d.done:
+	case <-timer.C:
+		// a sink that blocks sees a cancelled context
+		d.cancel()
+		<-d.done
+	}
+}
+
+func (d *sinkDispatcher) loop() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Event, 0, d.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		d.deliver(batch)
+		batch = make([]Event, 0, d.batchSize)
+	}
+	for {
+		select {
+		case event, ok := <-d.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= d.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (d *sinkDispatcher) deliver(batch []Event) {
+	backoff := d.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := d.sink.Send(d.ctx, batch)
+		if err == nil {
+			return
+		}
+		var serr *SendError
+		if errors.As(err, &serr) && len(serr.Events) > 0 {
+			batch = serr.Events
+		}
+		if d.retries > 0 && attempt >= d.retries || !d.wait(backoff) {
+			d.fail(batch, err)
+			return
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// wait sleeps for the backoff. It reports false once the sink context
+// is cancelled or, with unlimited retries, once Close is called.
+func (d *sinkDispatcher) wait(backoff time.Duration) bool {
+	var closing <-chan struct{}
+	if d.retries == 0 {
+		closing = d.closing
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-closing:
+		return false
+	case <-d.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (d *sinkDispatcher) fail(events []Event, err error) {
+	if d.onError != nil {
+		d.onError(events, err)
+	}
+}
+
+// JSONLinesSink writes one JSON document per event.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: bufio.NewWriter(w)}
+}
+
+func (s *JSONLinesSink) Send(_ context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encoder := json.NewEncoder(s.w)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+type WebhookOption func(*WebhookSink)
+
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(s *WebhookSink) {
+		s.notifier.client = client
+	}
+}
+
+func WithWebhookHeader(key, value string) WebhookOption {
+	return func(s *WebhookSink) {
+		s.header.Set(key, value)
+	}
+}
+
+// WebhookSink posts every batch as a JSON array to one URL, one attempt
+// per batch. Retries are set on the dispatcher with WithSinkRetry.
+type WebhookSink struct {
+	url      string
+	header   http.Header
+	notifier *WebhookNotifier
+}
+
+func NewWebhookSink(url string, opts ...WebhookOption) *WebhookSink {
+	s := &WebhookSink{
+		url:      url,
+		header:   make(http.Header),
+		notifier: &WebhookNotifier{client: &http.Client{Timeout: 10 * time.Second}},
+	}
+	for _, f := range opts {
+		f(s)
+	}
+	return s
+}
+
+func (s *WebhookSink) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return s.notifier.post(ctx, s.url, body, s.header)
+}
+
+// ChannelSink sends events to a Go channel.
+type ChannelSink struct {
+	ch chan<- Event
+}
+
+func NewChannelSink(ch chan<- Event) *ChannelSink {
+	return &ChannelSink{ch: ch}
+}
+
+func (s *ChannelSink) Send(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case s.ch <- event:
+		}
+	}
+	return nil
+}
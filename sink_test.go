@@ -0,0 +1,231 @@
+package spinix
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEngineEventSink(t *testing.T) {
+	ctx := context.Background()
+	ch := make(chan Event, 10)
+	var buf bytes.Buffer
+	engine := New(
+		WithEventSink(NewChannelSink(ch), WithSinkBatchSize(2)),
+		WithEventSink(NewJSONLinesSink(&buf), WithSinkFlushInterval(time.Millisecond)),
+	)
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 3 {
+		t.Fatalf("have %d events, want 3", len(ch))
+	}
+	var lines int
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Kind != EventRule {
+			t.Fatalf("have %s, want %s", event.Kind, EventRule)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Fatalf("have %d lines, want 3", lines)
+	}
+	// the report is still processed once the sinks are closed
+	events, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("have %d events, want 1", len(events))
+	}
+}
+
+func TestWebhookSinkRetry(t *testing.T) {
+	var calls, received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var events []Event
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&received, int32(len(events)))
+	}))
+	defer server.Close()
+
+	var failed int
+	engine := New(WithEventSink(NewWebhookSink(server.URL),
+		WithSinkRetry(3, time.Millisecond, 10*time.Millisecond),
+		WithSinkError(func(events []Event, err error) {
+			failed += len(events)
+		})))
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	if err := engine.publish(context.Background(), []Event{{ID: "1", Device: *device}, {ID: "2", Device: *device}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || received != 2 || failed != 0 {
+		t.Fatalf("have %d calls, %d received, %d failed, want 2, 2, 0", calls, received, failed)
+	}
+}
+
+func TestEventSinkGiveUp(t *testing.T) {
+	var failed int
+	engine := New(WithEventSink(sinkFunc(func(ctx context.Context, events []Event) error {
+		return errors.New("unavailable")
+	}),
+		WithSinkRetry(2, time.Millisecond, time.Millisecond),
+		WithSinkError(func(events []Event, err error) {
+			failed += len(events)
+		})))
+	if err := engine.publish(context.Background(), []Event{{ID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Fatalf("have %d failed, want 1", failed)
+	}
+}
+
+func TestEventSinkCloseBlocked(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed int
+		closed int
+	)
+	engine := New(WithEventSink(sinkFunc(func(ctx context.Context, events []Event) error {
+		return errors.New("unavailable")
+	}),
+		WithSinkBuffer(1),
+		WithSinkBatchSize(1),
+		WithSinkRetry(0, time.Millisecond, time.Millisecond),
+		WithSinkError(func(events []Event, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed += len(events)
+			if errors.Is(err, ErrSinkClosed) {
+				closed += len(events)
+			}
+		})))
+	events := make([]Event, 10)
+	published := make(chan error, 1)
+	go func() {
+		published <- engine.publish(context.Background(), events)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	closeDone := make(chan struct{})
+	go func() {
+		_ = engine.Close()
+		close(closeDone)
+	}()
+	select {
+	case <-closeDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close blocked by a full queue")
+	}
+	if err := <-published; !errors.Is(err, ErrSinkClosed) {
+		t.Fatalf("have %v, want ErrSinkClosed", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if failed != len(events) || closed == 0 {
+		t.Fatalf("have %d failed, %d closed, want %d failed", failed, closed, len(events))
+	}
+}
+
+type sinkFunc func(ctx context.Context, events []Event) error
+
+func (f sinkFunc) Send(ctx context.Context, events []Event) error {
+	return f(ctx, events)
+}
+
+func TestEventSinkCloseStalled(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed []error
+	)
+	// nobody reads the channel
+	engine := New(WithEventSink(NewChannelSink(make(chan Event)),
+		WithSinkBatchSize(1),
+		WithSinkCloseTimeout(10*time.Millisecond),
+		WithSinkError(func(events []Event, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		})))
+	if err := engine.publish(context.Background(), make([]Event, 1)); err != nil {
+		t.Fatal(err)
+	}
+	closeDone := make(chan struct{})
+	go func() {
+		_ = engine.Close()
+		close(closeDone)
+	}()
+	select {
+	case <-closeDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close blocked by a stalled sink")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || !errors.Is(failed[0], context.Canceled) {
+		t.Fatalf("have %v, want one context.Canceled", failed)
+	}
+}
+
+func TestEventSinkCloseBackoff(t *testing.T) {
+	var failed int32
+	engine := New(WithEventSink(sinkFunc(func(ctx context.Context, events []Event) error {
+		return errors.New("unavailable")
+	}),
+		WithSinkBatchSize(1),
+		WithSinkRetry(3, time.Minute, time.Minute),
+		WithSinkCloseTimeout(10*time.Millisecond),
+		WithSinkError(func(events []Event, err error) {
+			atomic.AddInt32(&failed, int32(len(events)))
+		})))
+	if err := engine.publish(context.Background(), make([]Event, 1)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("have %s, want close without waiting for the backoff", elapsed)
+	}
+	if atomic.LoadInt32(&failed) != 1 {
+		t.Fatalf("have %d, want 1 failed event", failed)
+	}
+}
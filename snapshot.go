@@ -0,0 +1,138 @@
+package spinix
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	snapshotFormat  = "spinix"
+	snapshotVersion = 1
+)
+
+var ErrSnapshotFormat = errors.New("spinix/snapshot: invalid format")
+
+const (
+	recordHeader recordKind = "header"
+	recordEnd    recordKind = "end"
+)
+
+type snapshotHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Time    int64  `json:"time"`
+}
+
+type snapshotEnd struct {
+	Records int `json:"records"`
+}
+
+func (e *Engine) Snapshot(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	var records int
+	write := func(kind recordKind, v interface{}) error {
+		data, err := encodeRecord(kind, opPut, v)
+		if err != nil {
+			return err
+		}
+		records++
+		return writeWalRecord(zw, data)
+	}
+	if err := write(recordHeader, snapshotHeader{
+		Format:  snapshotFormat,
+		Version: snapshotVersion,
+		Time:    e.clock.Now().Unix(),
+	}); err != nil {
+		return err
+	}
+	if err := dumpRefs(context.Background(), e.refs, write); err != nil {
+		return err
+	}
+	if err := write(recordEnd, snapshotEnd{Records: records}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Restore merges the snapshot into the engine stores. The records are
+// staged in memory stores first, a truncated or corrupt snapshot leaves
+// the engine unchanged.
+func (e *Engine) Restore(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	defer zr.Close()
+	ctx := context.Background()
+	staged := defaultRefs()
+	var (
+		records int
+		header  bool
+		end     bool
+	)
+	if _, err := readWalRecords(zr, func(data []byte) error {
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		if end {
+			return fmt.Errorf("%w: records after the end marker", ErrSnapshotFormat)
+		}
+		records++
+		switch rec.Kind {
+		case recordHeader:
+			var h snapshotHeader
+			if err := json.Unmarshal(rec.Data, &h); err != nil {
+				return err
+			}
+			if h.Format != snapshotFormat || h.Version < 1 || h.Version > snapshotVersion {
+				return fmt.Errorf("%w: unsupported %s version %d", ErrSnapshotFormat, h.Format, h.Version)
+			}
+			header = true
+			return nil
+		case recordEnd:
+			var se snapshotEnd
+			if err := json.Unmarshal(rec.Data, &se); err != nil {
+				return err
+			}
+			if se.Records != records-1 {
+				return fmt.Errorf("%w: have %d, want %d records", ErrSnapshotFormat, records-1, se.Records)
+			}
+			end = true
+			return nil
+		}
+		if !header {
+			return fmt.Errorf("%w: header not found", ErrSnapshotFormat)
+		}
+		return applyRecord(ctx, staged, rec)
+	}); err != nil {
+		return err
+	}
+	if !header || !end {
+		return fmt.Errorf("%w: unexpected end of snapshot", ErrSnapshotFormat)
+	}
+	if err := dumpRefs(ctx, staged, func(kind recordKind, v interface{}) error {
+		data, err := encodeRecord(kind, opPut, v)
+		if err != nil {
+			return err
+		}
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		return applyRecord(ctx, e.refs, rec)
+	}); err != nil {
+		return err
+	}
+	if s, ok := e.refs.rules.(ruleScanner); ok {
+		s.scan(e.refIndex.add)
+	}
+	if err := e.invalidateDangling(ctx); err != nil {
+		return err
+	}
+	return e.rebuildOccupancy(ctx)
+}
@@ -0,0 +1,152 @@
+package spinix
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEngineSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	source := New()
+	layer := NewLayer("yards")
+	if err := source.Layers().InsertOrReplace(ctx, layer); err != nil {
+		t.Fatal(err)
+	}
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := source.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := source.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	if events, _, err := source.Detect(ctx, device); err != nil || len(events) != 1 {
+		t.Fatalf("have %d events, %v, want 1 event", len(events), err)
+	}
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	target := New()
+	if err := target.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Layers().Lookup(ctx, layer.ID); err != nil {
+		t.Fatal(err)
+	}
+	var objects int
+	if err := target.Objects().Near(ctx, DefaultLayer, 42.9236075, -72.2792333, 100,
+		func(ctx context.Context, o *GeoObject) error {
+			objects++
+			return nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if objects == 0 {
+		t.Fatal("have 0, want restored object in the region index")
+	}
+	var rules int
+	if err := target.Rules().Walk(ctx, 42.9236075, -72.2792333,
+		func(ctx context.Context, r *Rule, err error) error {
+			if r.ID() == rule.ID() {
+				rules++
+			}
+			return err
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if rules != 1 {
+		t.Fatalf("have %d, want 1 restored rule in the region index", rules)
+	}
+	var devices int
+	if err := target.Devices().Near(ctx, 42.9236075, -72.2792333, 100,
+		func(ctx context.Context, d *Device) error {
+			devices++
+			return nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if devices != 1 {
+		t.Fatalf("have %d, want 1 restored device in the region index", devices)
+	}
+	events, _, err := target.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("have %d, want 0 events after restore of the trigger state", len(events))
+	}
+	if err := target.DeleteObject(ctx, object.ID()); !errors.Is(err, ErrReferenced) {
+		t.Fatalf("have %v, want ErrReferenced", err)
+	}
+
+	// cut the end marker off, every record before it is still readable
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var truncated bytes.Buffer
+	zw := gzip.NewWriter(&truncated)
+	if _, err := zw.Write(data[:len(data)-8]); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	unchanged := New()
+	if err := unchanged.Restore(&truncated); err == nil {
+		t.Fatal("have nil, want error for truncated snapshot")
+	}
+	if _, err := unchanged.Layers().Lookup(ctx, layer.ID); !errors.Is(err, ErrLayerNotFound) {
+		t.Fatalf("have %v, want ErrLayerNotFound after truncated snapshot", err)
+	}
+	if _, err := unchanged.Objects().Lookup(ctx, object.ID()); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("have %v, want ErrObjectNotFound after truncated snapshot", err)
+	}
+	if err := New().Restore(bytes.NewReader([]byte("not a snapshot"))); !errors.Is(err, ErrSnapshotFormat) {
+		t.Fatalf("have %v, want ErrSnapshotFormat", err)
+	}
+}
+
+func TestEngineRestoreInvalidRules(t *testing.T) {
+	ctx := context.Background()
+	source := New(WithDeletePolicy(DeleteInvalidate))
+	object := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := source.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := source.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.DeleteObject(ctx, object.ID()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	target := New(WithDeletePolicy(DeleteInvalidate))
+	if err := target.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := target.InvalidRules(); len(invalid) != 1 || invalid[0] != rule.ID() {
+		t.Fatalf("have %v, want [%s]", invalid, rule.ID())
+	}
+	if err := target.Objects().Add(ctx, object); err != nil {
+		t.Fatal(err)
+	}
+	if invalid := target.InvalidRules(); len(invalid) != 0 {
+		t.Fatalf("have %v, want no invalid rules", invalid)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -88,6 +89,16 @@ func (ms *memoryState) RemoveByDevice(_ context.Context, did DeviceID) (err erro
 	return
 }
 
+func (ms *memoryState) scan(fn func(*State)) {
+	for _, bucket := range ms.indexByID {
+		bucket.RLock()
+		for _, state := range bucket.index {
+			fn(state)
+		}
+		bucket.RUnlock()
+	}
+}
+
 func newStateIndex() stateIndex {
 	buckets := make([]*stateBucket, numBucket)
 	for i := 0; i < numBucket; i++ {
@@ -113,10 +124,47 @@ type StateID struct {
 	rid RuleID
 }
 
+func NewStateID(did DeviceID, rid RuleID) StateID {
+	return StateID{did: did, rid: rid}
+}
+
+func (s StateID) DeviceID() DeviceID {
+	return s.did
+}
+
+func (s StateID) RuleID() RuleID {
+	return s.rid
+}
+
 func (s StateID) String() string {
 	return s.did.String() + ":" + s.rid.String()
 }
 
+func (s StateID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *StateID) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	parts := strings.Split(str, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("spinix/state: invalid state id %q", str)
+	}
+	did, err := xid.FromString(parts[0])
+	if err != nil {
+		return err
+	}
+	rid, err := xid.FromString(parts[1])
+	if err != nil {
+		return err
+	}
+	s.did, s.rid = did, rid
+	return nil
+}
+
 type State struct {
 	id            StateID
 	now           int64
@@ -135,12 +183,14 @@ type StateSnapshot struct {
 	ObjectsVisits map[string]int64 `json:"objectsVisits"`
 }
 
+type stateSnapshot StateSnapshot
+
 func (s StateSnapshot) MarshalJSON() ([]byte, error) {
-	return json.Marshal(s)
+	return json.Marshal(stateSnapshot(s))
 }
 
 func (s *StateSnapshot) UnmarshalJSON(data []byte) error {
-	return json.Unmarshal(data, s)
+	return json.Unmarshal(data, (*stateSnapshot)(s))
 }
 
 func (s *State) FromSnapshot(snap StateSnapshot) {
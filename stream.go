@@ -0,0 +1,72 @@
+package spinix
+
+import (
+	"context"
+	"sync"
+)
+
+type EventBatch struct {
+	Device *Device
+	Events []Event
+	Err    error
+}
+
+func (e *Engine) Stream(ctx context.Context, in <-chan *Device) <-chan EventBatch {
+	out := make(chan EventBatch, e.streamBuffer)
+	shards := make([]chan *Device, e.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < len(shards); i++ {
+		shards[i] = make(chan *Device, e.streamBuffer)
+		wg.Add(1)
+		go func(queue <-chan *Device) {
+			defer wg.Done()
+			e.streamWorker(ctx, queue, out)
+		}(shards[i])
+	}
+	go func() {
+		defer func() {
+			for _, shard := range shards {
+				close(shard)
+			}
+			wg.Wait()
+			close(out)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case device, ok := <-in:
+				if !ok {
+					return
+				}
+				if device == nil {
+					continue
+				}
+				// all reports of one device go to the same shard to keep them in order
+				shard := shards[bucketFromID(device.ID, len(shards))]
+				select {
+				case <-ctx.Done():
+					return
+				case shard <- device:
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (e *Engine) streamWorker(ctx context.Context, queue <-chan *Device, out chan<- EventBatch) {
+	for device := range queue {
+		if ctx.Err() != nil {
+			continue
+		}
+		events, _, err := e.Detect(ctx, device)
+		if len(events) == 0 && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case out <- EventBatch{Device: device, Events: events, Err: err}:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineStream(t *testing.T) {
+	ctx := context.Background()
+	engine := New(WithDetectWorkers(4), WithStreamBuffer(1))
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg)`); err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan *Device)
+	out := engine.Stream(ctx, in)
+	go func() {
+		for i := 0; i < 10; i++ {
+			device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+			device.DateTime = int64(i)
+			in <- device
+			in <- makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.3792333)
+		}
+		close(in)
+	}()
+	var last int64 = -1
+	var batches int
+	for batch := range out {
+		if batch.Err != nil {
+			t.Fatal(batch.Err)
+		}
+		if batch.Device.DateTime <= last {
+			t.Fatalf("have %d after %d, want ordered reports", batch.Device.DateTime, last)
+		}
+		last = batch.Device.DateTime
+		batches++
+	}
+	if have, want := batches, 10; have != want {
+		t.Fatalf("have %d, want %d batches", have, want)
+	}
+}
+
+func TestEngineStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := New()
+	in := make(chan *Device)
+	out := engine.Stream(ctx, in)
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("have batch, want closed stream")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream was not closed after cancel")
+	}
+}
@@ -0,0 +1,92 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func WithDeviceTTL(ttl time.Duration) Option {
+	return func(e *Engine) {
+		e.deviceTTL = ttl
+	}
+}
+
+func WithDeviceOffline(fn ...OfflineFunc) Option {
+	return func(e *Engine) {
+		e.offline = append(e.offline, fn...)
+	}
+}
+
+// SweepDevices removes devices whose last report is older than the TTL
+// like DeleteDevice does and returns the number of removed devices.
+// Under DeleteReject the devices referenced by rules are kept.
+func (e *Engine) SweepDevices(ctx context.Context) (int, error) {
+	if e.deviceTTL <= 0 {
+		return 0, nil
+	}
+	scanner, ok := e.refs.devices.(deviceScanner)
+	if !ok {
+		return 0, fmt.Errorf("spinix/engine: %T does not support scanning", e.refs.devices)
+	}
+	cutoff := e.clock.Now().Add(-e.deviceTTL).Unix()
+	var stale []DeviceID
+	scanner.scan(func(d *Device) {
+		if d.DateTime < cutoff {
+			stale = append(stale, d.ID)
+		}
+	})
+	var removed int
+	for _, id := range stale {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		// the device may have reported again since the scan
+		device, err := e.refs.devices.Lookup(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrDeviceNotFound) {
+				continue
+			}
+			return removed, err
+		}
+		if device.DateTime >= cutoff {
+			continue
+		}
+		last := *device
+		if err := e.DeleteDevice(ctx, id); err != nil {
+			// referenced devices stay under the reject policy
+			if errors.Is(err, ErrDeviceNotFound) || errors.Is(err, ErrReferenced) {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+		for _, offlineFunc := range e.offline {
+			offlineFunc(&last)
+		}
+	}
+	return removed, nil
+}
+
+// RunDeviceSweeper calls SweepDevices every interval until the context is done.
+func (e *Engine) RunDeviceSweeper(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = e.deviceTTL
+	}
+	if interval <= 0 {
+		return fmt.Errorf("spinix/engine: device sweep interval not specified")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := e.SweepDevices(ctx); err != nil && !errors.Is(err, ctx.Err()) {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package spinix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngineSweepDevices(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	var offline []DeviceID
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithDeviceTTL(10*time.Minute),
+		WithDeviceOffline(func(d *Device) {
+			offline = append(offline, d.ID)
+		}),
+	)
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, `device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :trigger once }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	active := makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.2792333)
+	for _, device := range []*Device{stale, active} {
+		if _, _, err := engine.Detect(ctx, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(5 * time.Minute)
+	if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauog", 42.9236075, -72.2792333)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(6 * time.Minute)
+	removed, err := engine.SweepDevices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || len(offline) != 1 || offline[0] != stale.ID {
+		t.Fatalf("have %d removed, %v offline, want [%s]", removed, offline, stale.ID)
+	}
+	if _, err := engine.Devices().Lookup(ctx, stale.ID); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("have %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := engine.States().Lookup(ctx, StateID{did: stale.ID, rid: rule.ID()}); !errors.Is(err, ErrStateNotFound) {
+		t.Fatalf("have %v, want ErrStateNotFound", err)
+	}
+	if _, err := engine.Devices().Lookup(ctx, active.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.States().Lookup(ctx, StateID{did: active.ID, rid: rule.ID()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngineSweepDevicesSpatialIndex(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithDeviceTTL(10*time.Minute),
+	)
+	// the second report is within 50 meters of the first one
+	for _, lat := range []float64{42.9236075, 42.9236575} {
+		if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", lat, -72.2792333)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(11 * time.Minute)
+	if removed, err := engine.SweepDevices(ctx); err != nil || removed != 1 {
+		t.Fatalf("have %d removed, %v, want 1", removed, err)
+	}
+	var found int
+	if err := engine.Devices().Near(ctx, 42.9236075, -72.2792333, 500, func(_ context.Context, _ *Device) error {
+		found++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if found != 0 {
+		t.Fatalf("have %d devices near, want 0", found)
+	}
+	if have := engine.refs.devices.(*devices).regionIndex.size(); have != 0 {
+		t.Fatalf("have %d regions, want 0", have)
+	}
+}
+
+func TestEngineSweepDevicesPolicy(t *testing.T) {
+	ctx := context.Background()
+	spec := `devices(c5vj26evvhfjvfseauk0) INTERSECTS devices(c5vj26evvhfjvfseauog) { :center 42.9236075 -72.2792333 :radius 5km }`
+	for _, policy := range []DeletePolicy{DeleteReject, DeleteCascade} {
+		now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+		engine := New(
+			WithClock(ClockFunc(func() time.Time { return now })),
+			WithDeviceTTL(10*time.Minute),
+			WithDeletePolicy(policy),
+		)
+		rule, err := engine.AddRule(ctx, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := engine.Detect(ctx, makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(11 * time.Minute)
+		removed, err := engine.SweepDevices(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ruleErr := engine.Rules().Lookup(ctx, rule.ID())
+		switch policy {
+		case DeleteReject:
+			if removed != 0 || ruleErr != nil {
+				t.Fatalf("%s: have %d removed, %v, want referenced device kept", policy, removed, ruleErr)
+			}
+		case DeleteCascade:
+			if removed != 1 || !errors.Is(ruleErr, ErrRuleNotFound) {
+				t.Fatalf("%s: have %d removed, %v, want rule removed", policy, removed, ruleErr)
+			}
+		}
+	}
+}
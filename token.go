@@ -59,6 +59,13 @@ const (
 	CENTER         // center
 	EXPIRE         // expire
 	RESET          // reset
+	SILENCE        // silence
+	TRAVELLED      // travelled
+	STOPPED        // stopped
+	WEBHOOK        // webhook
+	OCCUPANCY      // occupancy
+	CONVOY         // convoy
+	MAXAGE         // maxage
 	literalEnd
 
 	operatorBegin
@@ -179,6 +186,14 @@ var tokens = [...]string{
 	CENTER:  "center",
 	EXPIRE:  "expire",
 	RADIUS:  "radius",
+	SILENCE: "silence",
+
+	TRAVELLED: "travelled",
+	STOPPED:   "stopped",
+	WEBHOOK:   "webhook",
+	OCCUPANCY: "occupancy",
+	CONVOY:    "convoy",
+	MAXAGE:    "maxage",
 
 	DEVICE:         "device",
 	VAR_IDENT:      "@",
@@ -310,6 +325,7 @@ var propsToken = map[Token]struct{}{
 	CENTER:  {},
 	RADIUS:  {},
 	LAYER:   {},
+	WEBHOOK: {},
 }
 
 var dateToken = map[Token]struct{}{
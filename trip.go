@@ -0,0 +1,284 @@
+package spinix
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mmadfox/geojson"
+	"github.com/mmadfox/geojson/geo"
+	"github.com/mmadfox/geojson/geometry"
+)
+
+type EventKind string
+
+const (
+	EventRule EventKind = "rule"
+	EventTrip EventKind = "trip"
+	EventStop EventKind = "stop"
+)
+
+type Trip struct {
+	Start        Position      `json:"start"`
+	End          Position      `json:"end"`
+	Distance     float64       `json:"distance"`
+	Duration     time.Duration `json:"duration"`
+	MaxSpeed     float64       `json:"maxSpeed"`
+	AvgSpeed     float64       `json:"avgSpeed"`
+	StartObjects []ObjectID    `json:"startObjects,omitempty"`
+	EndObjects   []ObjectID    `json:"endObjects,omitempty"`
+}
+
+type Stop struct {
+	Position Position      `json:"position"`
+	Start    int64         `json:"start"`
+	End      int64         `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Objects  []ObjectID    `json:"objects,omitempty"`
+}
+
+func MakeTripEvent(d *Device, trip *Trip, dateTime int64) Event {
+	return Event{
+		ID:       makeEventID(EventTrip, d.ID, "", trip.End.DateTime, nil, trip.Start.DateTime),
+		Kind:     EventTrip,
+		Device:   *d,
+		DateTime: dateTime,
+		Trip:     trip,
+	}
+}
+
+func MakeStopEvent(d *Device, stop *Stop, dateTime int64) Event {
+	return Event{
+		ID:       makeEventID(EventStop, d.ID, "", stop.End, nil, stop.Start),
+		Kind:     EventStop,
+		Device:   *d,
+		DateTime: dateTime,
+		Stop:     stop,
+	}
+}
+
+type TripOption func(*tripDetector)
+
+// WithStopSpeed sets the speed, in device units, below which the device
+// is considered standing still.
+func WithStopSpeed(speed float64) TripOption {
+	return func(t *tripDetector) {
+		t.stopSpeed = speed
+	}
+}
+
+func WithStopRadius(meters float64) TripOption {
+	return func(t *tripDetector) {
+		t.stopRadius = meters
+	}
+}
+
+func WithStopDuration(d time.Duration) TripOption {
+	return func(t *tripDetector) {
+		t.stopDuration = int64(d.Seconds())
+	}
+}
+
+// WithTrips enables trip and stop segmentation. Detect emits an EventTrip
+// when a trip ends with a stop and an EventStop when the device leaves it.
+func WithTrips(opts ...TripOption) Option {
+	return func(e *Engine) {
+		t := &tripDetector{
+			stopSpeed:    5,
+			stopRadius:   50,
+			stopDuration: int64((5 * time.Minute).Seconds()),
+			buckets:      make([]*tripBucket, numBucket),
+		}
+		for _, f := range opts {
+			f(t)
+		}
+		for i := 0; i < numBucket; i++ {
+			t.buckets[i] = &tripBucket{
+				index: make(map[DeviceID]*tripState),
+			}
+		}
+		e.trips = t
+	}
+}
+
+type tripMode int
+
+const (
+	tripUnknown tripMode = iota
+	tripMoving
+	tripStopped
+)
+
+type tripDetector struct {
+	stopSpeed    float64
+	stopRadius   float64
+	stopDuration int64
+	buckets      []*tripBucket
+}
+
+type tripBucket struct {
+	sync.Mutex
+	index map[DeviceID]*tripState
+}
+
+type tripState struct {
+	mode tripMode
+	last Position
+
+	// candidate stop
+	slow   bool
+	anchor Position
+
+	// current trip and its copy taken when the candidate stop began
+	trip     tripAcc
+	tripStop tripAcc
+
+	// confirmed stop
+	stop Position
+}
+
+type tripAcc struct {
+	start    Position
+	end      Position
+	distance float64
+	maxSpeed float64
+	sumSpeed float64
+	fixes    int
+}
+
+func (a *tripAcc) begin(p Position) {
+	*a = tripAcc{start: p, end: p, maxSpeed: p.Speed, sumSpeed: p.Speed, fixes: 1}
+}
+
+func (a *tripAcc) add(p Position) {
+	a.distance += geo.DistanceTo(a.end.Latitude, a.end.Longitude, p.Latitude, p.Longitude)
+	a.end = p
+	if p.Speed > a.maxSpeed {
+		a.maxSpeed = p.Speed
+	}
+	a.sumSpeed += p.Speed
+	a.fixes++
+}
+
+func (a tripAcc) trip() *Trip {
+	trip := &Trip{
+		Start:    a.start,
+		End:      a.end,
+		Distance: a.distance,
+		Duration: time.Duration(a.end.DateTime-a.start.DateTime) * time.Second,
+		MaxSpeed: a.maxSpeed,
+	}
+	if a.fixes > 0 {
+		trip.AvgSpeed = a.sumSpeed / float64(a.fixes)
+	}
+	return trip
+}
+
+func (t *tripDetector) bucket(id DeviceID) *tripBucket {
+	return t.buckets[bucketFromID(id, numBucket)]
+}
+
+func (t *tripDetector) update(d *Device, dateTime int64) (trip *Trip, stop *Stop) {
+	p := PositionFromDevice(d)
+	p.DateTime = dateTime
+	bucket := t.bucket(d.ID)
+	bucket.Lock()
+	defer bucket.Unlock()
+	s, ok := bucket.index[d.ID]
+	if !ok {
+		s = &tripState{}
+		bucket.index[d.ID] = s
+		s.last = p
+		s.slow = p.Speed < t.stopSpeed
+		s.anchor = p
+		if !s.slow {
+			s.mode = tripMoving
+			s.trip.begin(p)
+		}
+		return
+	}
+	if p.DateTime < s.last.DateTime {
+		return
+	}
+	prev := s.last
+	s.last = p
+	if s.mode == tripMoving {
+		s.trip.add(p)
+	}
+
+	slow := p.Speed < t.stopSpeed
+	near := geo.DistanceTo(s.anchor.Latitude, s.anchor.Longitude, p.Latitude, p.Longitude) <= t.stopRadius
+	moved := !(s.slow && slow && near)
+	if moved && s.mode != tripMoving {
+		if s.mode == tripStopped {
+			stop = &Stop{
+				Position: s.stop,
+				Start:    s.stop.DateTime,
+				End:      prev.DateTime,
+				Duration: time.Duration(prev.DateTime-s.stop.DateTime) * time.Second,
+			}
+		}
+		s.mode = tripMoving
+		s.trip.begin(prev)
+		s.trip.add(p)
+	}
+	if moved {
+		s.slow = slow
+		s.anchor = p
+		s.tripStop = s.trip
+	}
+	if s.slow && s.mode != tripStopped && p.DateTime-s.anchor.DateTime >= t.stopDuration {
+		if s.mode == tripMoving {
+			trip = s.tripStop.trip()
+		}
+		s.mode = tripStopped
+		s.stop = s.anchor
+	}
+	return
+}
+
+func (t *tripDetector) delete(id DeviceID) {
+	bucket := t.bucket(id)
+	bucket.Lock()
+	delete(bucket.index, id)
+	bucket.Unlock()
+}
+
+func (e *Engine) detectTrip(ctx context.Context, d *Device, dateTime int64) ([]Event, error) {
+	trip, stop := e.trips.update(d, dateTime)
+	var events []Event
+	if stop != nil {
+		objects, err := e.objectsAt(ctx, d.Layer, stop.Position)
+		if err != nil {
+			return nil, err
+		}
+		stop.Objects = objects
+		events = append(events, MakeStopEvent(d, stop, dateTime))
+	}
+	if trip != nil {
+		var err error
+		if trip.StartObjects, err = e.objectsAt(ctx, d.Layer, trip.Start); err != nil {
+			return nil, err
+		}
+		if trip.EndObjects, err = e.objectsAt(ctx, d.Layer, trip.End); err != nil {
+			return nil, err
+		}
+		events = append(events, MakeTripEvent(d, trip, dateTime))
+	}
+	return events, nil
+}
+
+func (e *Engine) objectsAt(ctx context.Context, lid LayerID, p Position) (ids []ObjectID, err error) {
+	if locator, ok := e.refs.objects.(objectLocator); ok {
+		locator.at(lid, p.Latitude, p.Longitude, func(o *GeoObject) {
+			ids = append(ids, o.ID())
+		})
+		return ids, nil
+	}
+	point := geojson.NewPoint(geometry.Point{X: p.Latitude, Y: p.Longitude})
+	err = e.refs.objects.Search(ctx, lid, point, SearchIntersects, func(_ context.Context, o *GeoObject) error {
+		ids = append(ids, o.ID())
+		return nil
+	})
+	return ids, err
+}
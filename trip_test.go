@@ -0,0 +1,80 @@
+package spinix
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineTrips(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	engine := New(
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithTrips(WithStopSpeed(3), WithStopRadius(50), WithStopDuration(5*time.Minute)),
+	)
+	depot := str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)
+	if err := engine.Objects().Add(ctx, depot); err != nil {
+		t.Fatal(err)
+	}
+	reports := []struct {
+		lat, lon, speed float64
+	}{
+		// parked in the depot
+		{42.9236075, -72.2792333, 0},
+		{42.9236075, -72.2792333, 0},
+		{42.9236075, -72.2792333, 0},
+		{42.9236075, -72.2792333, 0},
+		{42.9236075, -72.2792333, 0},
+		{42.9236075, -72.2792333, 0},
+		// driving
+		{42.9260000, -72.2800000, 40},
+		{42.9290000, -72.2805000, 55},
+		{42.9314328, -72.2812945, 20},
+		// parked
+		{42.9314328, -72.2812945, 0},
+		{42.9314328, -72.2812945, 0},
+		{42.9314328, -72.2812945, 0},
+		{42.9314328, -72.2812945, 0},
+		{42.9314328, -72.2812945, 0},
+		{42.9314328, -72.2812945, 0},
+		// leaving
+		{42.9330000, -72.2820000, 30},
+	}
+	var events []Event
+	for _, r := range reports {
+		device := makeDevice("c5vj26evvhfjvfseauk0", r.lat, r.lon)
+		device.Speed = r.speed
+		res, _, err := engine.Detect(ctx, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, res...)
+		now = now.Add(time.Minute)
+	}
+	if len(events) != 3 {
+		t.Fatalf("have %d events, want 3", len(events))
+	}
+	if events[0].Kind != EventStop || events[0].Stop.Duration != 5*time.Minute {
+		t.Fatalf("have %v, want 5m stop", events[0])
+	}
+	if len(events[0].Stop.Objects) != 1 || events[0].Stop.Objects[0] != depot.ID() {
+		t.Fatalf("have %v, want stop in the depot", events[0].Stop.Objects)
+	}
+	trip := events[1].Trip
+	if events[1].Kind != EventTrip || trip == nil {
+		t.Fatalf("have %v, want trip", events[1])
+	}
+	if trip.Duration != 4*time.Minute || trip.MaxSpeed != 55 {
+		t.Fatalf("have %s %.0f, want 4m 55", trip.Duration, trip.MaxSpeed)
+	}
+	if trip.Distance < 800 || trip.Distance > 1000 {
+		t.Fatalf("have %.0f meters, want ~880", trip.Distance)
+	}
+	if len(trip.StartObjects) != 1 || len(trip.EndObjects) != 0 {
+		t.Fatalf("have %v %v, want start in the depot", trip.StartObjects, trip.EndObjects)
+	}
+	if events[2].Kind != EventStop || events[2].Stop.Duration != 5*time.Minute {
+		t.Fatalf("have %v, want 5m stop", events[2])
+	}
+}
@@ -0,0 +1,130 @@
+package spinix
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const walHeaderSize = 8
+
+var (
+	walTable      = crc32.MakeTable(crc32.Castagnoli)
+	errWalCorrupt = errors.New("spinix/wal: corrupt record")
+)
+
+// walWriter appends length-prefixed, checksummed records to a file.
+type walWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	sync bool
+	n    int
+}
+
+func openWalWriter(filename string, offset int64, sync bool) (*walWriter, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// drop a torn tail left by a crash in the middle of a write
+	if err := file.Truncate(offset); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &walWriter{
+		file: file,
+		buf:  bufio.NewWriter(file),
+		sync: sync,
+	}, nil
+}
+
+func (w *walWriter) append(data []byte) error {
+	if err := writeWalRecord(w.buf, data); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	w.n++
+	if w.sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *walWriter) reset() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.buf.Reset(w.file)
+	w.n = 0
+	return w.file.Sync()
+}
+
+func (w *walWriter) close() error {
+	if err := w.buf.Flush(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func writeWalRecord(w io.Writer, data []byte) error {
+	var header [walHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(data, walTable))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readWalRecords calls fn for every intact record and returns the offset
+// right after the last one. A torn or corrupt record ends the log.
+func readWalRecords(r io.Reader, fn func(data []byte) error) (offset int64, err error) {
+	reader := bufio.NewReader(r)
+	var header [walHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		sum := binary.LittleEndian.Uint32(header[4:8])
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return offset, err
+		}
+		if crc32.Checksum(data, walTable) != sum {
+			return offset, nil
+		}
+		if err := fn(data); err != nil {
+			return offset, fmt.Errorf("%w at offset %d: %v", errWalCorrupt, offset, err)
+		}
+		offset += int64(walHeaderSize) + int64(size)
+	}
+}
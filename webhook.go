@@ -0,0 +1,281 @@
+package spinix
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Spinix-Signature"
+	EventIDHeader   = "X-Spinix-Event"
+
+	defaultWebhookTemplate = `{{json .}}`
+)
+
+type NotifierOption func(*WebhookNotifier) error
+
+func WithNotifierSecret(secret []byte) NotifierOption {
+	return func(n *WebhookNotifier) error {
+		n.secret = secret
+		return nil
+	}
+}
+
+// WithNotifierTemplate sets the text/template used to build the request
+// body. The template is executed with the Event, the json function
+// renders any value as JSON.
+func WithNotifierTemplate(text string) NotifierOption {
+	return func(n *WebhookNotifier) (err error) {
+		n.template, err = parseWebhookTemplate(text)
+		return err
+	}
+}
+
+// WithNotifierRetry sets the retries of Notify. It has no effect on
+// the notifier registered with WithEventSink, see WithSinkRetry.
+func WithNotifierRetry(retries int, minBackoff, maxBackoff time.Duration) NotifierOption {
+	return func(n *WebhookNotifier) error {
+		if retries < 0 {
+			return fmt.Errorf("spinix/webhook: negative retries %d", retries)
+		}
+		n.retries = retries
+		n.minBackoff = minBackoff
+		n.maxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// WithNotifierDeadLetter sets the file where Notify parks requests
+// once its retries are exhausted. On the sink path nothing is parked
+// unless Park is passed to WithSinkError.
+func WithNotifierDeadLetter(filename string) NotifierOption {
+	return func(n *WebhookNotifier) error {
+		n.deadLetter = filename
+		return nil
+	}
+}
+
+func WithNotifierClient(client *http.Client) NotifierOption {
+	return func(n *WebhookNotifier) error {
+		n.client = client
+		return nil
+	}
+}
+
+// WebhookNotifier posts every event to the webhook of its rule.
+// It implements EventSink, in that role the sink dispatcher owns the
+// retries and the notifier makes one attempt per event.
+type WebhookNotifier struct {
+	client     *http.Client
+	secret     []byte
+	template   *template.Template
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	deadLetter string
+	mu         sync.Mutex
+}
+
+type DeadLetter struct {
+	EventID  string `json:"eventID"`
+	URL      string `json:"url"`
+	Body     string `json:"body"`
+	Error    string `json:"error"`
+	DateTime int64  `json:"dateTime"`
+}
+
+func NewWebhookNotifier(opts ...NotifierOption) (*WebhookNotifier, error) {
+	tpl, err := parseWebhookTemplate(defaultWebhookTemplate)
+	if err != nil {
+		return nil, err
+	}
+	n := &WebhookNotifier{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		template:   tpl,
+		retries:    5,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: time.Minute,
+	}
+	for _, f := range opts {
+		if err := f(n); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Send posts every event once. The events that were not delivered are
+// returned in a SendError, so the sink dispatcher retries only them.
+// Use Park as the sink error function to keep the dead letter file.
+func (n *WebhookNotifier) Send(ctx context.Context, events []Event) error {
+	var (
+		failed []Event
+		first  error
+	)
+	for i := range events {
+		url := events[i].Rule.Webhook
+		if len(url) == 0 {
+			continue
+		}
+		body, err := n.render(events[i])
+		if err == nil {
+			err = n.post(ctx, url, body, http.Header{EventIDHeader: {events[i].ID}})
+		}
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed = append(failed, events[i])
+		}
+	}
+	if len(failed) > 0 {
+		return &SendError{Events: failed, Err: first}
+	}
+	return nil
+}
+
+// Park writes the events to the dead letter file. It matches
+// SinkErrorFunc and does nothing without a dead letter file.
+func (n *WebhookNotifier) Park(events []Event, err error) {
+	for i := range events {
+		url := events[i].Rule.Webhook
+		if len(url) == 0 {
+			continue
+		}
+		body, _ := n.render(events[i])
+		_ = n.park(DeadLetter{
+			EventID:  events[i].ID,
+			URL:      url,
+			Body:     string(body),
+			Error:    err.Error(),
+			DateTime: time.Now().Unix(),
+		})
+	}
+}
+
+// Notify delivers one event with the notifier retries. Events of rules
+// without a webhook are skipped.
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	url := event.Rule.Webhook
+	if len(url) == 0 {
+		return nil
+	}
+	body, err := n.render(event)
+	if err != nil {
+		return err
+	}
+	backoff := n.minBackoff
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > n.maxBackoff {
+				backoff = n.maxBackoff
+			}
+		}
+		if err = n.post(ctx, url, body, http.Header{EventIDHeader: {event.ID}}); err == nil {
+			return nil
+		}
+	}
+	return n.park(DeadLetter{
+		EventID:  event.ID,
+		URL:      url,
+		Body:     string(body),
+		Error:    err.Error(),
+		DateTime: time.Now().Unix(),
+	})
+}
+
+func (n *WebhookNotifier) render(event Event) ([]byte, error) {
+	var body bytes.Buffer
+	if err := n.template.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("spinix/webhook: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if len(n.secret) > 0 {
+		req.Header.Set(SignatureHeader, SignPayload(n.secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("spinix/webhook: %s responded with %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) park(letter DeadLetter) error {
+	if len(n.deadLetter) == 0 {
+		return fmt.Errorf("spinix/webhook: event %s not delivered: %s", letter.EventID, letter.Error)
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.deadLetter, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SignPayload returns the value of the signature header for the body.
+func SignPayload(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifyPayload(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignPayload(secret, body)), []byte(signature))
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"quote": strconv.Quote,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("spinix/webhook: %w", err)
+	}
+	return tpl, nil
+}
@@ -0,0 +1,111 @@
+package spinix
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("secret")
+	var calls int32
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		if !VerifyPayload(secret, data, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body = data
+	}))
+	defer server.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	notifier, err := NewWebhookNotifier(
+		WithNotifierSecret(secret),
+		WithNotifierDeadLetter(deadLetter),
+		WithNotifierTemplate(`{"device":"{{.Device.ID}}","rule":"{{.Rule.RuleID}}","matches":{{len .Match}}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(WithEventSink(notifier,
+		WithSinkRetry(3, time.Millisecond, 5*time.Millisecond),
+		WithSinkError(notifier.Park)))
+	if err := engine.Objects().Add(ctx, str2obj("c5vj26evvhfjvfseaulg", testPolyCoords)); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := engine.AddRule(ctx, fmt.Sprintf(`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :webhook "%s" }`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.AddRule(ctx, fmt.Sprintf(`device INTERSECTS polygon(c5vj26evvhfjvfseaulg) { :webhook "%s" }`, broken.URL)); err != nil {
+		t.Fatal(err)
+	}
+	device := makeDevice("c5vj26evvhfjvfseauk0", 42.9236075, -72.2792333)
+	if _, _, err := engine.Detect(ctx, device); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the delivered event is not sent again while the broken one is retried
+	if calls != 3 {
+		t.Fatalf("have %d calls, want 3", calls)
+	}
+	var payload struct {
+		Device  string `json:"device"`
+		Rule    string `json:"rule"`
+		Matches int    `json:"matches"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	if payload.Device != device.ID.String() || payload.Rule != rule.ID().String() || payload.Matches != 1 {
+		t.Fatalf("have %+v", payload)
+	}
+	file, err := os.Open(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 1 || letters[0].URL != broken.URL {
+		t.Fatalf("have %v, want one dead letter for %s", letters, broken.URL)
+	}
+}
+
+func TestWebhookProp(t *testing.T) {
+	if _, err := NewRule(`speed gt 10 { :webhook "ftp://example.com" :center 42.9236075 -72.2792333 }`); err == nil {
+		t.Fatal("have nil, want error")
+	}
+	if _, err := NewWebhookNotifier(WithNotifierTemplate(`{{.Device`)); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}